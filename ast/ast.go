@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
 	"monkey/token"
 	"strings"
 )
@@ -12,6 +13,10 @@ type Node interface {
 	TokenLiteral() string
 	// String represntation for this Node
 	String() string
+	// Where the node starts in the source
+	Pos() token.Position
+	// Where the node ends in the source - the position just past its last character
+	End() token.Position
 }
 type Statement interface {
 	Node
@@ -28,6 +33,8 @@ type Expression interface {
 type Program struct {
 	// A slice of the AST nodes that implement the Statement interface
 	Statements []Statement
+	// Every comment in the source, in order - they aren't part of the tree, but a formatter needs them to put them back
+	Comments []token.Comment
 }
 func (p *Program) TokenLiteral() string {
 	if len(p.Statements) > 0 {
@@ -36,6 +43,18 @@ func (p *Program) TokenLiteral() string {
 		return ""
 	}
 }
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -46,6 +65,18 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+// A placeholder for a statement the parser could not make sense of - it covers the tokens skipped while recovering
+// so everything after it can still be parsed and used
+type BadStatement struct {
+	Token token.Token // The first token of the broken statement
+	To token.Position // Just past the last token that was skipped
+}
+func (bs *BadStatement) statementNode() {}
+func (bs *BadStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BadStatement) Pos() token.Position { return bs.Token.Start }
+func (bs *BadStatement) End() token.Position { return bs.To }
+func (bs *BadStatement) String() string { return "<bad statement>" }
+
 // One field for the identifier, one for the expression that produces the value, and one for the token
 type LetStatement struct {
 	Token token.Token // The token.LET token
@@ -54,6 +85,16 @@ type LetStatement struct {
 }
 func (ls *LetStatement) statementNode() {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Start }
+func (ls *LetStatement) End() token.Position {
+	if ls.Value != nil {
+		return ls.Value.End()
+	}
+	if ls.Name != nil {
+		return ls.Name.End()
+	}
+	return ls.Token.End
+}
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -77,6 +118,8 @@ type Identifier struct {
 func (i *Identifier) expressionNode() {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 func (i *Identifier) String() string { return i.Value }
+func (i *Identifier) Pos() token.Position { return i.Token.Start }
+func (i *Identifier) End() token.Position { return i.Token.End }
 
 type ReturnStatement struct {
 	Token		token.Token // The 'return' token
@@ -84,6 +127,13 @@ type ReturnStatement struct {
 }
 func (rs *ReturnStatement) statementNode()		{}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Start }
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue != nil {
+		return rs.ReturnValue.End()
+	}
+	return rs.Token.End
+}
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -98,12 +148,138 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// AST representation of a function declaration, e.g. fn add(a, b) { a + b }
+// The name is bound before anything else in the enclosing block runs, so declarations can call each other in any order
+type FunctionStatement struct {
+	Token 		token.Token // The 'fn' token
+	Name 		*Identifier
+	Function	*FunctionLiteral // Shares our token, and has Name filled in
+}
+func (fs *FunctionStatement) statementNode()		{}
+func (fs *FunctionStatement) TokenLiteral() string 	{ return fs.Token.Literal }
+func (fs *FunctionStatement) Pos() token.Position 	{ return fs.Token.Start }
+func (fs *FunctionStatement) End() token.Position {
+	if fs.Function != nil {
+		return fs.Function.End()
+	}
+	return fs.Name.End()
+}
+func (fs *FunctionStatement) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range fs.Function.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(fs.TokenLiteral() + " ")
+	out.WriteString(fs.Name.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(fs.Function.Body.String())
+
+	return out.String()
+}
+
+// AST representation of a while loop, e.g. while (x < 10) { ... }
+type WhileStatement struct {
+	Token 		token.Token // The 'while' token
+	Condition	Expression
+	Body		*BlockStatement
+}
+func (ws *WhileStatement) statementNode()		{}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position 	{ return ws.Token.Start }
+func (ws *WhileStatement) End() token.Position {
+	if ws.Body != nil {
+		return ws.Body.End()
+	}
+	return ws.Token.End
+}
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+// AST representation of a C-style for loop, e.g. for (let i = 0; i < 10; i += 1) { ... }
+// Any of the three clauses may be left out - without a condition the loop runs until something breaks out of it
+type ForStatement struct {
+	Token 		token.Token // The 'for' token
+	Init		Statement // A let or an expression statement, or nil
+	Condition	Expression // nil means forever
+	Post		Statement // Run after every pass through the body, or nil
+	Body		*BlockStatement
+}
+func (fs *ForStatement) statementNode()		{}
+func (fs *ForStatement) TokenLiteral() string 	{ return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position 	{ return fs.Token.Start }
+func (fs *ForStatement) End() token.Position {
+	if fs.Body != nil {
+		return fs.Body.End()
+	}
+	return fs.Token.End
+}
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Init != nil {
+		out.WriteString(strings.TrimSuffix(fs.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+	if fs.Post != nil {
+		out.WriteString(strings.TrimSuffix(fs.Post.String(), ";"))
+	}
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+// AST representation of a break statement - leaves the innermost loop
+type BreakStatement struct {
+	Token token.Token // The 'break' token
+}
+func (bs *BreakStatement) statementNode()		{}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string 		{ return bs.Token.Literal + ";" }
+func (bs *BreakStatement) Pos() token.Position 	{ return bs.Token.Start }
+func (bs *BreakStatement) End() token.Position 	{ return bs.Token.End }
+
+// AST representation of a continue statement - skips to the next pass of the innermost loop
+type ContinueStatement struct {
+	Token token.Token // The 'continue' token
+}
+func (cs *ContinueStatement) statementNode()		{}
+func (cs *ContinueStatement) TokenLiteral() string 	{ return cs.Token.Literal }
+func (cs *ContinueStatement) String() string 		{ return cs.Token.Literal + ";" }
+func (cs *ContinueStatement) Pos() token.Position 	{ return cs.Token.Start }
+func (cs *ContinueStatement) End() token.Position 	{ return cs.Token.End }
+
 type ExpressionStatement struct {
 	Token 		token.Token // the firtst token of the expression
 	Expression 	Expression
 }
 func (es *ExpressionStatement) statementNode() 		 {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position { return es.Token.Start }
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+	return es.Token.End
+}
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -119,6 +295,60 @@ type IntegerLiteral struct {
 func (il *IntegerLiteral) expressionNode()		{}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string 		{ return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position 	{ return il.Token.Start }
+func (il *IntegerLiteral) End() token.Position 	{ return il.Token.End }
+
+// AST representation of a floating point literal - String() keeps the spelling from the source, so 1e3 doesn't turn into 1000
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+func (fl *FloatLiteral) expressionNode()		{}
+func (fl *FloatLiteral) TokenLiteral() string 	{ return fl.Token.Literal }
+func (fl *FloatLiteral) String() string 		{ return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position 	{ return fl.Token.Start }
+func (fl *FloatLiteral) End() token.Position 	{ return fl.Token.End }
+
+// AST representation of a string literal - the lexer has already decoded the escapes, so Value holds the actual characters
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+func (sl *StringLiteral) expressionNode()		{}
+func (sl *StringLiteral) TokenLiteral() string 	{ return sl.Token.Literal }
+func (sl *StringLiteral) String() string 		{ return QuoteString(sl.Value) }
+func (sl *StringLiteral) Pos() token.Position 	{ return sl.Token.Start }
+func (sl *StringLiteral) End() token.Position 	{ return sl.Token.End }
+
+// Write s back out as a Monkey string literal, escaping whatever the lexer would otherwise trip over
+func QuoteString(s string) string {
+	var out bytes.Buffer
+
+	out.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		default:
+			if r < ' ' || r == 0x7f { // Other control characters are spelled out as code points
+				out.WriteString(fmt.Sprintf(`\u{%x}`, r))
+			} else {
+				out.WriteRune(r)
+			}
+		}
+	}
+	out.WriteByte('"')
+
+	return out.String()
+}
 
 // AST representation of a boolean
 type Boolean struct {
@@ -128,16 +358,32 @@ type Boolean struct {
 func (b *Boolean) expressionNode()		{}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
 func (b *Boolean) String() string 		{ return b.Token.Literal }
+func (b *Boolean) Pos() token.Position 	{ return b.Token.Start }
+func (b *Boolean) End() token.Position 	{ return b.Token.End }
 
 // AST representation of an if statement
 type IfExpression struct {
 	Token token.Token // The 'if' token
 	Condition Expression
 	Consequence *BlockStatement
+	ElseIfs []*ElseIf // Any 'else if' branches, tried in order after Condition
 	Alternative *BlockStatement
 }
 func (ie *IfExpression) expressionNode()	  {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Start }
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	if len(ie.ElseIfs) > 0 {
+		return ie.ElseIfs[len(ie.ElseIfs)-1].End()
+	}
+	if ie.Consequence != nil {
+		return ie.Consequence.End()
+	}
+	return ie.Token.End
+}
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -146,6 +392,10 @@ func (ie *IfExpression) String() string {
 	out.WriteString(" ")
 	out.WriteString(ie.Consequence.String())
 
+	for _, ei := range ie.ElseIfs {
+		out.WriteString(ei.String())
+	}
+
 	if ie.Alternative != nil {
 		out.WriteString("else ")
 		out.WriteString(ie.Alternative.String())
@@ -154,13 +404,49 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// One 'else if (condition) { ... }' link in the chain of an if expression
+type ElseIf struct {
+	Token token.Token // The 'else' token
+	Condition Expression
+	Consequence *BlockStatement
+}
+func (ei *ElseIf) TokenLiteral() string { return ei.Token.Literal }
+func (ei *ElseIf) Pos() token.Position  { return ei.Token.Start }
+func (ei *ElseIf) End() token.Position {
+	if ei.Consequence != nil {
+		return ei.Consequence.End()
+	}
+	return ei.Token.End
+}
+func (ei *ElseIf) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("else if")
+	out.WriteString(ei.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ei.Consequence.String())
+
+	return out.String()
+}
+
 // AST representation of a block statement
 type BlockStatement struct {
 	Token token.Token // the { token
 	Statements []Statement
+	Rbrace token.Token // the closing } token
 }
 func (bs *BlockStatement) statementNode()		{}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Start }
+func (bs *BlockStatement) End() token.Position {
+	if bs.Rbrace.End.IsValid() {
+		return bs.Rbrace.End
+	}
+	if len(bs.Statements) > 0 {
+		return bs.Statements[len(bs.Statements)-1].End()
+	}
+	return bs.Token.End
+}
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -174,11 +460,19 @@ func (bs *BlockStatement) String() string {
 // AST representation for a function literal
 type FunctionLiteral struct {
 	Token 		token.Token // the 'fn' token
-	Parameters  []*Identifier
+	Parameters  []*Parameter
 	Body		*BlockStatement
+	Name		string // What the function was bound to, by a let or a declaration - empty for an anonymous function
 }
 func (fl *FunctionLiteral) expressionNode()		 {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Start }
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+	return fl.Token.End
+}
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -188,6 +482,9 @@ func (fl *FunctionLiteral) String() string {
 	}
 
 	out.WriteString(fl.TokenLiteral())
+	if fl.Name != "" {
+		out.WriteString(fmt.Sprintf("<%s>", fl.Name))
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(")")
@@ -196,14 +493,52 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// One parameter of a function literal - a plain name (a), a name with a default value (b = 2) or a rest parameter (...rest)
+type Parameter struct {
+	Token 		token.Token // The parameter's name, or the '...' of a rest parameter
+	Name 		*Identifier
+	Default 	Expression // Evaluated when the call doesn't pass this argument - nil for a required parameter
+	Rest 		bool // Collects the leftover arguments into an array - only ever the last parameter
+}
+func (p *Parameter) TokenLiteral() string 	{ return p.Token.Literal }
+func (p *Parameter) Pos() token.Position 	{ return p.Token.Start }
+func (p *Parameter) End() token.Position {
+	if p.Default != nil {
+		return p.Default.End()
+	}
+	return p.Name.End()
+}
+func (p *Parameter) String() string {
+	if p.Rest {
+		return "..." + p.Name.String()
+	}
+	if p.Default != nil {
+		return p.Name.String() + " = " + p.Default.String()
+	}
+	return p.Name.String()
+}
+
 // AST representation of a call expression
 type CallExpression struct {
 	Token 	 	token.Token // The '(' token
 	Function	Expression // Identifier or function literal
 	Arguments 	[]Expression
+	Rparen		token.Token // The closing ')' token
 }
 func (ce *CallExpression) expressionNode() 		{}
 func (ce *CallExpression) TokenLiteral() string	{ return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position {
+	if ce.Function != nil {
+		return ce.Function.Pos()
+	}
+	return ce.Token.Start
+}
+func (ce *CallExpression) End() token.Position {
+	if ce.Rparen.End.IsValid() {
+		return ce.Rparen.End
+	}
+	return ce.Token.End
+}
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -220,6 +555,250 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// xs |> f(a) - passes the value on the left as the first argument of the call on the right
+type PipeExpression struct {
+	Token 	token.Token // The '|>' token
+	Left 	Expression
+	Right 	Expression // Usually a call, but any expression that evaluates to a function works
+}
+func (pe *PipeExpression) expressionNode()		{}
+func (pe *PipeExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PipeExpression) Pos() token.Position {
+	if pe.Left != nil {
+		return pe.Left.Pos()
+	}
+	return pe.Token.Start
+}
+func (pe *PipeExpression) End() token.Position {
+	if pe.Right != nil {
+		return pe.Right.End()
+	}
+	return pe.Token.End
+}
+func (pe *PipeExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(pe.Left.String())
+	out.WriteString(" |> ")
+	out.WriteString(pe.Right.String())
+	out.WriteString(")")
+	return out.String()
+}
+
+// The call this pipeline stands for: x |> f(a) is f(x, a) and x |> f is f(x)
+// Built fresh each time, so the evaluator and the compiler can treat it like any other call without touching the tree
+// That also means the function is evaluated before the piped value, the same as in the call it stands for
+func (pe *PipeExpression) Call() *CallExpression {
+	if call, ok := pe.Right.(*CallExpression); ok {
+		arguments := append([]Expression{pe.Left}, call.Arguments...)
+		return &CallExpression{Token: call.Token, Function: call.Function, Arguments: arguments, Rparen: call.Rparen}
+	}
+	return &CallExpression{Token: pe.Token, Function: pe.Right, Arguments: []Expression{pe.Left}}
+}
+
+// cond ? a : b - only one of the two branches is evaluated
+type ConditionalExpression struct {
+	Token 		token.Token // The '?' token
+	Condition 	Expression
+	Consequence	Expression
+	Alternative	Expression
+}
+func (ce *ConditionalExpression) expressionNode()		{}
+func (ce *ConditionalExpression) TokenLiteral() string 	{ return ce.Token.Literal }
+func (ce *ConditionalExpression) Pos() token.Position {
+	if ce.Condition != nil {
+		return ce.Condition.Pos()
+	}
+	return ce.Token.Start
+}
+func (ce *ConditionalExpression) End() token.Position {
+	if ce.Alternative != nil {
+		return ce.Alternative.End()
+	}
+	return ce.Token.End
+}
+func (ce *ConditionalExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ce.Condition.String())
+	out.WriteString(" ? ")
+	out.WriteString(ce.Consequence.String())
+	out.WriteString(" : ")
+	out.WriteString(ce.Alternative.String())
+	out.WriteString(")")
+	return out.String()
+}
+
+// AST representation of a logical expression, e.g. a && b
+// Kept apart from InfixExpression because the right side is only evaluated if the left side doesn't already decide the result
+type LogicalExpression struct {
+	Token 		token.Token // The operator token, && or ||
+	Left 		Expression
+	Operator	string
+	Right 		Expression
+}
+func (le *LogicalExpression) expressionNode()		{}
+func (le *LogicalExpression) TokenLiteral() string 	{ return le.Token.Literal }
+func (le *LogicalExpression) Pos() token.Position {
+	if le.Left != nil {
+		return le.Left.Pos()
+	}
+	return le.Token.Start
+}
+func (le *LogicalExpression) End() token.Position {
+	if le.Right != nil {
+		return le.Right.End()
+	}
+	return le.Token.End
+}
+func (le *LogicalExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(le.Left.String())
+	out.WriteString(" " + le.Operator + " ")
+	out.WriteString(le.Right.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// AST representation of an assignment to an existing binding, e.g. x = 5, arr[i] += 1
+// Target is always an *Identifier or an *IndexExpression - the parser rejects anything else
+type AssignExpression struct {
+	Token 		token.Token // The operator token, = or one of the compound ones like +=
+	Target 		Expression
+	Operator	string
+	Value 		Expression
+}
+func (ae *AssignExpression) expressionNode()		{}
+func (ae *AssignExpression) TokenLiteral() string 	{ return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position {
+	if ae.Target != nil {
+		return ae.Target.Pos()
+	}
+	return ae.Token.Start
+}
+func (ae *AssignExpression) End() token.Position {
+	if ae.Value != nil {
+		return ae.Value.End()
+	}
+	return ae.Token.End
+}
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// The infix operator a compound assignment applies, e.g. + for += - empty for a plain =
+func (ae *AssignExpression) BinaryOperator() string {
+	return strings.TrimSuffix(ae.Operator, "=")
+}
+
+// AST representation of an array literal, e.g. [1, 2 * 3, fn(x) { x }]
+type ArrayLiteral struct {
+	Token 		token.Token // The '[' token
+	Elements 	[]Expression
+	Rbracket 	token.Token // The closing ']' token
+}
+func (al *ArrayLiteral) expressionNode()		{}
+func (al *ArrayLiteral) TokenLiteral() string 	{ return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position 	{ return al.Token.Start }
+func (al *ArrayLiteral) End() token.Position {
+	if al.Rbracket.End.IsValid() {
+		return al.Rbracket.End
+	}
+	return al.Token.End
+}
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// AST representation of an index expression, e.g. myArray[i + 1]
+type IndexExpression struct {
+	Token 		token.Token // The '[' token
+	Left 		Expression // Whatever we are indexing into
+	Index 		Expression
+	Rbracket 	token.Token // The closing ']' token
+}
+func (ie *IndexExpression) expressionNode()		 {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+	return ie.Token.Start
+}
+func (ie *IndexExpression) End() token.Position {
+	if ie.Rbracket.End.IsValid() {
+		return ie.Rbracket.End
+	}
+	return ie.Token.End
+}
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// AST representation of a hash literal, e.g. {"name": "x", 1: true}
+// Any expression can be a key - whether it is usable as one is only known once it is evaluated
+type HashLiteral struct {
+	Token 		token.Token // The '{' token
+	Pairs 		[]HashPair // In the order they were written
+	Rbrace 		token.Token // The closing '}' token
+}
+// One key: value entry of a hash literal
+type HashPair struct {
+	Key 	Expression
+	Value 	Expression
+}
+func (hl *HashLiteral) expressionNode()		 {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Start }
+func (hl *HashLiteral) End() token.Position {
+	if hl.Rbrace.End.IsValid() {
+		return hl.Rbrace.End
+	}
+	return hl.Token.End
+}
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
 // AST representation of a prefix expression
 type PrefixExpression struct {
 	Token 		token.Token // The prefix token, e.g. !
@@ -228,6 +807,13 @@ type PrefixExpression struct {
 }
 func (pe *PrefixExpression) expressionNode()		{}
 func (pe *PrefixExpression) TokenLiteral() string 	{ return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position 	{ return pe.Token.Start }
+func (pe *PrefixExpression) End() token.Position {
+	if pe.Right != nil {
+		return pe.Right.End()
+	}
+	return pe.Token.End
+}
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -248,6 +834,18 @@ type InfixExpression struct {
 }
 func (oe *InfixExpression) expressionNode()		 {}
 func (oe *InfixExpression) TokenLiteral() string { return oe.Token.Literal }
+func (oe *InfixExpression) Pos() token.Position {
+	if oe.Left != nil {
+		return oe.Left.Pos()
+	}
+	return oe.Token.Start
+}
+func (oe *InfixExpression) End() token.Position {
+	if oe.Right != nil {
+		return oe.Right.End()
+	}
+	return oe.Token.End
+}
 func (oe *InfixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -0,0 +1,153 @@
+package ast
+
+import "fmt"
+
+// Gets every node of the tree, children first, and hands back the node that should take its place - often just the one it got
+type ModifierFunc func(Node) Node
+
+// Rewrite the tree from the bottom up: the children of a node are modified (and replaced in place) before the node itself is
+// A replacement has to fit where the original was - an expression for an expression, a block for a block and so on - or we panic
+// Positions aren't touched, so a node made up by the modifier reports whatever positions it was given
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+	case *Program:
+		modifyStatements(n.Statements, modifier)
+
+	case *LetStatement:
+		n.Name = modifyChild(n.Name, modifier)
+		if n.Value != nil {
+			n.Value = modifyChild(n.Value, modifier)
+		}
+
+	case *ReturnStatement:
+		if n.ReturnValue != nil {
+			n.ReturnValue = modifyChild(n.ReturnValue, modifier)
+		}
+
+	case *FunctionStatement:
+		n.Name = modifyChild(n.Name, modifier)
+		n.Function = modifyChild(n.Function, modifier)
+
+	case *WhileStatement:
+		n.Condition = modifyChild(n.Condition, modifier)
+		n.Body = modifyChild(n.Body, modifier)
+
+	case *ForStatement:
+		if n.Init != nil {
+			n.Init = modifyChild(n.Init, modifier)
+		}
+		if n.Condition != nil {
+			n.Condition = modifyChild(n.Condition, modifier)
+		}
+		if n.Post != nil {
+			n.Post = modifyChild(n.Post, modifier)
+		}
+		n.Body = modifyChild(n.Body, modifier)
+
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			n.Expression = modifyChild(n.Expression, modifier)
+		}
+
+	case *BlockStatement:
+		modifyStatements(n.Statements, modifier)
+
+	case *IfExpression:
+		n.Condition = modifyChild(n.Condition, modifier)
+		n.Consequence = modifyChild(n.Consequence, modifier)
+		for i, ei := range n.ElseIfs {
+			n.ElseIfs[i] = modifyChild(ei, modifier)
+		}
+		if n.Alternative != nil {
+			n.Alternative = modifyChild(n.Alternative, modifier)
+		}
+
+	case *ElseIf:
+		n.Condition = modifyChild(n.Condition, modifier)
+		n.Consequence = modifyChild(n.Consequence, modifier)
+
+	case *FunctionLiteral:
+		for i, p := range n.Parameters {
+			n.Parameters[i] = modifyChild(p, modifier)
+		}
+		n.Body = modifyChild(n.Body, modifier)
+
+	case *Parameter:
+		n.Name = modifyChild(n.Name, modifier)
+		if n.Default != nil {
+			n.Default = modifyChild(n.Default, modifier)
+		}
+
+	case *CallExpression:
+		n.Function = modifyChild(n.Function, modifier)
+		modifyExpressions(n.Arguments, modifier)
+
+	case *PipeExpression:
+		n.Left = modifyChild(n.Left, modifier)
+		n.Right = modifyChild(n.Right, modifier)
+
+	case *ConditionalExpression:
+		n.Condition = modifyChild(n.Condition, modifier)
+		n.Consequence = modifyChild(n.Consequence, modifier)
+		n.Alternative = modifyChild(n.Alternative, modifier)
+
+	case *LogicalExpression:
+		n.Left = modifyChild(n.Left, modifier)
+		n.Right = modifyChild(n.Right, modifier)
+
+	case *AssignExpression:
+		n.Target = modifyChild(n.Target, modifier)
+		n.Value = modifyChild(n.Value, modifier)
+
+	case *ArrayLiteral:
+		modifyExpressions(n.Elements, modifier)
+
+	case *IndexExpression:
+		n.Left = modifyChild(n.Left, modifier)
+		n.Index = modifyChild(n.Index, modifier)
+
+	case *HashLiteral:
+		for i, pair := range n.Pairs {
+			n.Pairs[i] = HashPair{Key: modifyChild(pair.Key, modifier), Value: modifyChild(pair.Value, modifier)}
+		}
+
+	case *PrefixExpression:
+		n.Right = modifyChild(n.Right, modifier)
+
+	case *InfixExpression:
+		n.Left = modifyChild(n.Left, modifier)
+		n.Right = modifyChild(n.Right, modifier)
+	}
+
+	return modifier(node)
+}
+
+func modifyStatements(statements []Statement, modifier ModifierFunc) {
+	for i, s := range statements {
+		statements[i] = modifyChild(s, modifier)
+	}
+}
+
+func modifyExpressions(expressions []Expression, modifier ModifierFunc) {
+	for i, e := range expressions {
+		expressions[i] = modifyChild(e, modifier)
+	}
+}
+
+// Modify a child and make sure whatever comes back can go where the child was
+func modifyChild[T Node](child T, modifier ModifierFunc) T {
+	result := Modify(child, modifier)
+	modified, ok := result.(T)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: can't replace %s with %s", nodeType(child), nodeType(result)))
+	}
+	return modified
+}
+
+// The Go type of a node, for error messages
+func nodeType(node Node) string {
+	if node == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("%T", node)
+}
@@ -0,0 +1,236 @@
+package ast
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok {
+			return node
+		}
+
+		if integer.Value != 1 {
+			return node
+		}
+
+		integer.Value = 2
+		return integer
+	}
+
+	tests := []struct {
+		input		Node
+		expected	Node
+	}{
+		{
+			one(),
+			two(),
+		},
+		{
+			&Program{
+				Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				},
+			},
+			&Program{
+				Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				},
+			},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&IfExpression{
+				Condition: one(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+				ElseIfs: []*ElseIf{
+					{
+						Condition: one(),
+						Consequence: &BlockStatement{
+							Statements: []Statement{
+								&ExpressionStatement{Expression: one()},
+							},
+						},
+					},
+				},
+				Alternative: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&IfExpression{
+				Condition: two(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+				ElseIfs: []*ElseIf{
+					{
+						Condition: two(),
+						Consequence: &BlockStatement{
+							Statements: []Statement{
+								&ExpressionStatement{Expression: two()},
+							},
+						},
+					},
+				},
+				Alternative: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&ReturnStatement{ReturnValue: one()},
+			&ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&LetStatement{Value: one()},
+			&LetStatement{Value: two()},
+		},
+		{
+			&FunctionLiteral{
+				Parameters: []*Parameter{
+					{Name: &Identifier{Value: "a"}, Default: one()},
+				},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&FunctionLiteral{
+				Parameters: []*Parameter{
+					{Name: &Identifier{Value: "a"}, Default: two()},
+				},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one(), one()}},
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{two(), two()}},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+		{
+			&HashLiteral{Pairs: []HashPair{{Key: one(), Value: one()}}},
+			&HashLiteral{Pairs: []HashPair{{Key: two(), Value: two()}}},
+		},
+		{
+			&ForStatement{
+				Init: &ExpressionStatement{Expression: one()},
+				Body: &BlockStatement{Statements: []Statement{}},
+			},
+			&ForStatement{
+				Init: &ExpressionStatement{Expression: two()},
+				Body: &BlockStatement{Statements: []Statement{}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		equal := reflect.DeepEqual(modified, tt.expected)
+		if !equal {
+			t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected)
+		}
+	}
+}
+
+// The modifier can hand back a different node altogether, and the parent picks it up
+func TestModifyReplacesNodes(t *testing.T) {
+	// !x becomes (x == false)
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{Expression: &CallExpression{
+				Function:	&Identifier{Value: "f"},
+				Arguments:	[]Expression{&PrefixExpression{Operator: "!", Right: &Identifier{Value: "x"}}},
+			}},
+		},
+	}
+
+	Modify(program, func(node Node) Node {
+		prefix, ok := node.(*PrefixExpression)
+		if !ok || prefix.Operator != "!" {
+			return node
+		}
+		return &InfixExpression{Left: prefix.Right, Operator: "==", Right: &Boolean{Value: false}}
+	})
+
+	call := program.Statements[0].(*ExpressionStatement).Expression.(*CallExpression)
+	if _, ok := call.Arguments[0].(*InfixExpression); !ok {
+		t.Fatalf("argument was not replaced. got=%T", call.Arguments[0])
+	}
+}
+
+// Children are modified before their parents, so the modifier sees the new children
+func TestModifyIsBottomUp(t *testing.T) {
+	var order []string
+	Modify(&InfixExpression{Left: &Identifier{Value: "a"}, Operator: "+", Right: &Identifier{Value: "b"}}, func(node Node) Node {
+		switch n := node.(type) {
+		case *Identifier:
+			order = append(order, n.Value)
+		case *InfixExpression:
+			order = append(order, n.Operator)
+		}
+		return node
+	})
+
+	if strings.Join(order, " ") != "a b +" {
+		t.Errorf("wrong order. want \"a b +\", got=%q", strings.Join(order, " "))
+	}
+}
+
+func TestModifyRejectsMisfits(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r != "ast.Modify: can't replace *ast.BlockStatement with *ast.IntegerLiteral" {
+			t.Errorf("wrong panic. got=%v", r)
+		}
+	}()
+
+	body := &BlockStatement{Statements: []Statement{}}
+	Modify(&WhileStatement{Condition: &Boolean{Value: true}, Body: body}, func(node Node) Node {
+		if node == body {
+			return &IntegerLiteral{Value: 1}
+		}
+		return node
+	})
+
+	t.Errorf("expected a panic")
+}
@@ -0,0 +1,165 @@
+package ast
+
+// Walking the tree the same way go/ast does, so a pass over the AST only has to handle the nodes it cares about
+
+// Visit is called for every node Walk reaches - the Visitor it hands back is used for that node's children, and nil skips them
+// Once the children are done, Walk calls Visit(nil) on that returned Visitor, so it knows the node is finished
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Depth-first, in the order the children appear in the source - nil children (like a missing else) are skipped
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+
+	case *LetStatement:
+		Walk(v, n.Name)
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+
+	case *ReturnStatement:
+		if n.ReturnValue != nil {
+			Walk(v, n.ReturnValue)
+		}
+
+	case *FunctionStatement:
+		Walk(v, n.Name)
+		Walk(v, n.Function)
+
+	case *WhileStatement:
+		Walk(v, n.Condition)
+		Walk(v, n.Body)
+
+	case *ForStatement:
+		if n.Init != nil {
+			Walk(v, n.Init)
+		}
+		if n.Condition != nil {
+			Walk(v, n.Condition)
+		}
+		if n.Post != nil {
+			Walk(v, n.Post)
+		}
+		Walk(v, n.Body)
+
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			Walk(v, n.Expression)
+		}
+
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+
+	case *IfExpression:
+		Walk(v, n.Condition)
+		Walk(v, n.Consequence)
+		for _, ei := range n.ElseIfs {
+			Walk(v, ei)
+		}
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+
+	case *ElseIf:
+		Walk(v, n.Condition)
+		Walk(v, n.Consequence)
+
+	case *FunctionLiteral:
+		for _, p := range n.Parameters {
+			Walk(v, p)
+		}
+		Walk(v, n.Body)
+
+	case *Parameter:
+		Walk(v, n.Name)
+		if n.Default != nil {
+			Walk(v, n.Default)
+		}
+
+	case *CallExpression:
+		Walk(v, n.Function)
+		walkExpressions(v, n.Arguments)
+
+	case *PipeExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case *ConditionalExpression:
+		Walk(v, n.Condition)
+		Walk(v, n.Consequence)
+		Walk(v, n.Alternative)
+
+	case *LogicalExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case *AssignExpression:
+		Walk(v, n.Target)
+		Walk(v, n.Value)
+
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+
+	case *IndexExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Index)
+
+	case *HashLiteral:
+		// A pair isn't a node of its own, so the key and the value come one after the other
+		for _, pair := range n.Pairs {
+			Walk(v, pair.Key)
+			Walk(v, pair.Value)
+		}
+
+	case *PrefixExpression:
+		Walk(v, n.Right)
+
+	case *InfixExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean,
+		*BreakStatement, *ContinueStatement, *BadStatement:
+		// Nothing underneath
+
+	default:
+		panic("ast.Walk: unexpected node type " + nodeType(node))
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, statements []Statement) {
+	for _, s := range statements {
+		Walk(v, s)
+	}
+}
+
+func walkExpressions(v Visitor, expressions []Expression) {
+	for _, e := range expressions {
+		Walk(v, e)
+	}
+}
+
+// Lets a plain function act as a Visitor
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Walk the tree calling f on every node, and on nil once a node's children are done
+// Returning false from f skips the children of that node
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,129 @@
+package ast_test
+
+// An external test package, so we can let the parser build the trees instead of writing them out by hand
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestInspectOrder(t *testing.T) {
+	program := parse(t, "let x = 1 + f(2); if (x) { x } else if (!x) { 3 }")
+
+	var visited []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node != nil {
+			visited = append(visited, strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."))
+		}
+		return true
+	})
+
+	expected := []string{
+		"Program",
+		"LetStatement", "Identifier", "InfixExpression", "IntegerLiteral", "CallExpression", "Identifier", "IntegerLiteral",
+		"ExpressionStatement", "IfExpression", "Identifier",
+		"BlockStatement", "ExpressionStatement", "Identifier",
+		"ElseIf", "PrefixExpression", "Identifier", "BlockStatement", "ExpressionStatement", "IntegerLiteral",
+	}
+
+	if strings.Join(visited, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong visiting order.\nwant %v\ngot= %v", expected, visited)
+	}
+}
+
+// Every kind of node the parser can produce has to be walkable
+func TestInspectReachesEverything(t *testing.T) {
+	input := `
+let a = [1, 2.5, "s", true][0];
+let h = {"k": fn(x, y = 2, ...rest) { return x; }};
+fn add(a, b) { a + b }
+while (a < 10) { a += 1; if (a == 5) { break } else { continue } }
+for (let i = 0; i < 3; i = i + 1) { }
+for (;;) { break; }
+a && b || c ? d |> e(1) : -f;
+`
+	program := parse(t, input)
+
+	counts := map[string]int{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node != nil {
+			counts[strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")]++
+		}
+		return true
+	})
+
+	expected := map[string]int{
+		"LetStatement": 3, "ArrayLiteral": 1, "IndexExpression": 1, "FloatLiteral": 1, "StringLiteral": 2, "Boolean": 1,
+		"HashLiteral": 1, "FunctionLiteral": 2, "Parameter": 5, "ReturnStatement": 1, "FunctionStatement": 1,
+		"WhileStatement": 1, "ForStatement": 2, "AssignExpression": 2, "BreakStatement": 2, "ContinueStatement": 1,
+		"ConditionalExpression": 1, "LogicalExpression": 2, "PipeExpression": 1, "CallExpression": 1, "PrefixExpression": 1,
+	}
+
+	for kind, want := range expected {
+		if counts[kind] != want {
+			t.Errorf("visited %d %s nodes, want %d", counts[kind], kind, want)
+		}
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	program := parse(t, "let f = fn(x) { let y = x; y }; let z = 1;")
+
+	var names []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.FunctionLiteral:
+			return false // Don't go looking inside function bodies
+		case *ast.LetStatement:
+			names = append(names, n.Name.Value)
+		}
+		return true
+	})
+
+	if strings.Join(names, ",") != "f,z" {
+		t.Errorf("wrong let statements found. want f,z, got=%s", strings.Join(names, ","))
+	}
+}
+
+// Keeps track of how deep we are, to check Visit(nil) comes once for every node whose children were walked
+type depthVisitor struct {
+	depth		*int
+	maxDepth	*int
+}
+
+func (v depthVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		*v.depth -= 1
+		return nil
+	}
+	*v.depth += 1
+	if *v.depth > *v.maxDepth {
+		*v.maxDepth = *v.depth
+	}
+	return v
+}
+
+func TestWalkVisitsNilAfterChildren(t *testing.T) {
+	program := parse(t, "1 + (2 * 3)")
+
+	depth, maxDepth := 0, 0
+	ast.Walk(depthVisitor{&depth, &maxDepth}, program)
+
+	// Program > ExpressionStatement > + > * > 2
+	if depth != 0 || maxDepth != 5 {
+		t.Errorf("depth wrong after the walk. want 0 (max 5), got=%d (max %d)", depth, maxDepth)
+	}
+}
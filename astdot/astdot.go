@@ -0,0 +1,205 @@
+package astdot
+
+// The AST as a Graphviz DOT graph - String() hides what the parser actually built behind a wall of parentheses, a picture doesn't
+// Every node gets a box with its kind (and operator, name or value), every edge is labelled with the field it comes from
+// Render it with something like: dot -Tsvg tree.dot > tree.svg
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/ast"
+	"monkey/format"
+	"reflect"
+	"strings"
+)
+
+// The DOT document for a node and everything under it
+func Graph(node ast.Node) string {
+	g := &graph{}
+	g.out.WriteString("digraph AST {\n")
+	g.out.WriteString("\tnode [shape=box, fontname=\"Helvetica\"];\n")
+	g.out.WriteString("\tedge [fontname=\"Helvetica\", fontsize=10];\n")
+	g.node(g.newID(), node)
+	g.out.WriteString("}\n")
+	return g.out.String()
+}
+
+type graph struct {
+	out bytes.Buffer
+	next int // Id of the next node we hand out
+}
+
+func (g *graph) newID() string {
+	id := fmt.Sprintf("n%d", g.next)
+	g.next++
+	return id
+}
+
+// Write out a node under the given id, then its children
+func (g *graph) node(id string, node ast.Node) {
+	fmt.Fprintf(&g.out, "\t%s [label=\"%s\"];\n", id, escape(label(node)))
+
+	switch n := node.(type) {
+	case *ast.Program:
+		g.statements(id, "Statements", n.Statements)
+
+	case *ast.BadStatement, *ast.BreakStatement, *ast.ContinueStatement,
+		*ast.Identifier, *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean:
+		// Leaves
+
+	case *ast.LetStatement:
+		g.child(id, "Name", n.Name)
+		g.child(id, "Value", n.Value)
+
+	case *ast.ReturnStatement:
+		g.child(id, "ReturnValue", n.ReturnValue)
+
+	case *ast.FunctionStatement:
+		g.child(id, "Name", n.Name)
+		g.child(id, "Function", n.Function)
+
+	case *ast.WhileStatement:
+		g.child(id, "Condition", n.Condition)
+		g.child(id, "Body", n.Body)
+
+	case *ast.ForStatement:
+		g.child(id, "Init", n.Init)
+		g.child(id, "Condition", n.Condition)
+		g.child(id, "Post", n.Post)
+		g.child(id, "Body", n.Body)
+
+	case *ast.ExpressionStatement:
+		g.child(id, "Expression", n.Expression)
+
+	case *ast.BlockStatement:
+		g.statements(id, "Statements", n.Statements)
+
+	case *ast.PrefixExpression:
+		g.child(id, "Right", n.Right)
+
+	case *ast.InfixExpression:
+		g.child(id, "Left", n.Left)
+		g.child(id, "Right", n.Right)
+
+	case *ast.LogicalExpression:
+		g.child(id, "Left", n.Left)
+		g.child(id, "Right", n.Right)
+
+	case *ast.AssignExpression:
+		g.child(id, "Target", n.Target)
+		g.child(id, "Value", n.Value)
+
+	case *ast.PipeExpression:
+		g.child(id, "Left", n.Left)
+		g.child(id, "Right", n.Right)
+
+	case *ast.ConditionalExpression:
+		g.child(id, "Condition", n.Condition)
+		g.child(id, "Consequence", n.Consequence)
+		g.child(id, "Alternative", n.Alternative)
+
+	case *ast.IfExpression:
+		g.child(id, "Condition", n.Condition)
+		g.child(id, "Consequence", n.Consequence)
+		for i, ei := range n.ElseIfs {
+			g.child(id, fmt.Sprintf("ElseIfs[%d]", i), ei)
+		}
+		g.child(id, "Alternative", n.Alternative)
+
+	case *ast.ElseIf:
+		g.child(id, "Condition", n.Condition)
+		g.child(id, "Consequence", n.Consequence)
+
+	case *ast.FunctionLiteral:
+		for i, p := range n.Parameters {
+			g.child(id, fmt.Sprintf("Parameters[%d]", i), p)
+		}
+		g.child(id, "Body", n.Body)
+
+	case *ast.Parameter:
+		g.child(id, "Name", n.Name)
+		g.child(id, "Default", n.Default)
+
+	case *ast.CallExpression:
+		g.child(id, "Function", n.Function)
+		g.expressions(id, "Arguments", n.Arguments)
+
+	case *ast.ArrayLiteral:
+		g.expressions(id, "Elements", n.Elements)
+
+	case *ast.IndexExpression:
+		g.child(id, "Left", n.Left)
+		g.child(id, "Index", n.Index)
+
+	case *ast.HashLiteral:
+		for i, pair := range n.Pairs {
+			g.child(id, fmt.Sprintf("Key[%d]", i), pair.Key)
+			g.child(id, fmt.Sprintf("Value[%d]", i), pair.Value)
+		}
+
+	default:
+		panic(fmt.Sprintf("astdot.Graph: unexpected node type %T", n))
+	}
+}
+
+// An edge from parent to child, labelled with the field name - missing children (a for without an init, say) are left out
+func (g *graph) child(parent string, field string, node ast.Node) {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return
+	}
+	id := g.newID()
+	fmt.Fprintf(&g.out, "\t%s -> %s [label=\"%s\"];\n", parent, id, escape(field))
+	g.node(id, node)
+}
+
+func (g *graph) statements(parent string, field string, statements []ast.Statement) {
+	for i, s := range statements {
+		g.child(parent, fmt.Sprintf("%s[%d]", field, i), s)
+	}
+}
+
+func (g *graph) expressions(parent string, field string, expressions []ast.Expression) {
+	for i, e := range expressions {
+		g.child(parent, fmt.Sprintf("%s[%d]", field, i), e)
+	}
+}
+
+// The kind of node, and on a second line whatever tells it apart from its siblings
+func label(node ast.Node) string {
+	kind := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+
+	switch n := node.(type) {
+	case *ast.Identifier:
+		return kind + "\n" + n.Value
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean:
+		return kind + "\n" + format.Node(n) // Spelled the way the source had it, and still sensible for nodes made up by hand
+	case *ast.PrefixExpression:
+		return kind + "\n" + n.Operator
+	case *ast.InfixExpression:
+		return kind + "\n" + n.Operator
+	case *ast.LogicalExpression:
+		return kind + "\n" + n.Operator
+	case *ast.AssignExpression:
+		return kind + "\n" + n.Operator
+	case *ast.PipeExpression:
+		return kind + "\n|>"
+	case *ast.ConditionalExpression:
+		return kind + "\n?:"
+	case *ast.FunctionLiteral:
+		if n.Name != "" {
+			return kind + "\n" + n.Name
+		}
+	case *ast.Parameter:
+		if n.Rest {
+			return kind + "\n..."
+		}
+	}
+	return kind
+}
+
+// Make a string safe to put between double quotes in DOT
+func escape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
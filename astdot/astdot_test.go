@@ -0,0 +1,111 @@
+package astdot
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestGraph(t *testing.T) {
+	expected := `digraph AST {
+	node [shape=box, fontname="Helvetica"];
+	edge [fontname="Helvetica", fontsize=10];
+	n0 [label="Program"];
+	n0 -> n1 [label="Statements[0]"];
+	n1 [label="ExpressionStatement"];
+	n1 -> n2 [label="Expression"];
+	n2 [label="InfixExpression\n+"];
+	n2 -> n3 [label="Left"];
+	n3 [label="IntegerLiteral\n1"];
+	n2 -> n4 [label="Right"];
+	n4 [label="InfixExpression\n*"];
+	n4 -> n5 [label="Left"];
+	n5 [label="IntegerLiteral\n2"];
+	n4 -> n6 [label="Right"];
+	n6 [label="PrefixExpression\n-"];
+	n6 -> n7 [label="Right"];
+	n7 [label="Identifier\nx"];
+}
+`
+
+	graph := Graph(parse(t, "1 + 2 * -x"))
+	if graph != expected {
+		t.Errorf("wrong graph.\nwant:\n%s\ngot:\n%s", expected, graph)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`f(a, "say \"hi\"")`, []string{
+			`[label="CallExpression"]`,
+			`[label="Function"]`,
+			`[label="Arguments[0]"]`,
+			`[label="Arguments[1]"]`,
+			`[label="StringLiteral\n\"say \\\"hi\\\"\""]`,
+		}},
+		{"a ? b : c || d", []string{
+			`[label="ConditionalExpression\n?:"]`,
+			`[label="Condition"]`, `[label="Consequence"]`, `[label="Alternative"]`,
+			`[label="LogicalExpression\n||"]`,
+		}},
+		{"xs |> map(f)", []string{`[label="PipeExpression\n|>"]`}},
+		{"x += 0xFF", []string{`[label="AssignExpression\n+="]`, `[label="Target"]`, `[label="IntegerLiteral\n0xFF"]`}},
+		{"fn add(a, b = 1, ...rest) { a }", []string{
+			`[label="FunctionLiteral\nadd"]`,
+			`[label="Parameters[2]"]`,
+			`[label="Parameter\n..."]`,
+			`[label="Default"]`,
+			`[label="Body"]`,
+		}},
+		{"if (a) { 1 } else if (b) { 2 } else { 3 }", []string{`[label="ElseIfs[0]"]`, `[label="ElseIf"]`, `[label="Alternative"]`}},
+		{`{"k": [1.5, true]}[0]`, []string{
+			`[label="Key[0]"]`, `[label="Value[0]"]`, `[label="Elements[1]"]`,
+			`[label="FloatLiteral\n1.5"]`, `[label="Boolean\ntrue"]`, `[label="Index"]`,
+		}},
+		{"for (;;) { break }", []string{`[label="ForStatement"]`, `[label="Body"]`, `[label="BreakStatement"]`}},
+	}
+
+	for _, tt := range tests {
+		graph := Graph(parse(t, tt.input))
+		for _, want := range tt.expected {
+			if !strings.Contains(graph, want) {
+				t.Errorf("graph for %q is missing %s.\ngot:\n%s", tt.input, want, graph)
+			}
+		}
+	}
+}
+
+// Children that aren't there get no node and no edge
+func TestMissingChildren(t *testing.T) {
+	graph := Graph(parse(t, "for (;;) { }"))
+	for _, field := range []string{"Init", "Condition", "Post"} {
+		if strings.Contains(graph, field) {
+			t.Errorf("graph has a %s edge for a for loop without one:\n%s", field, graph)
+		}
+	}
+}
+
+func TestHandMadeNodes(t *testing.T) {
+	node := &ast.InfixExpression{Left: &ast.IntegerLiteral{Value: 4}, Operator: "-", Right: &ast.FloatLiteral{Value: 0.5}}
+
+	graph := Graph(node)
+	for _, want := range []string{`[label="IntegerLiteral\n4"]`, `[label="FloatLiteral\n0.5"]`} {
+		if !strings.Contains(graph, want) {
+			t.Errorf("graph is missing %s.\ngot:\n%s", want, graph)
+		}
+	}
+}
@@ -0,0 +1,656 @@
+package astjson
+
+// The AST as JSON, for tools written in other languages and for snapshot tests
+// Every node is an object whose "kind" names the Go type (without the ast. prefix), followed by its token, its span and its children
+// Positions are kept exactly, comments included, so decoding what we encoded gives back the very same tree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+	"reflect"
+)
+
+// Encode a node and everything under it
+func Marshal(node ast.Node) ([]byte, error) {
+	return json.Marshal(encode(node))
+}
+
+// Same as Marshal, but indented for people to read
+func MarshalIndent(node ast.Node, prefix string, indent string) ([]byte, error) {
+	return json.MarshalIndent(encode(node), prefix, indent)
+}
+
+// Rebuild whatever node the JSON describes
+func Unmarshal(data []byte) (ast.Node, error) {
+	d := &decoder{}
+	node := d.node(data)
+	if d.err != nil {
+		return nil, d.err
+	}
+	if node == nil {
+		return nil, fmt.Errorf("astjson: no node in input")
+	}
+	return node, nil
+}
+
+// Rebuild a whole program - anything other than a Program at the top is an error
+func UnmarshalProgram(data []byte) (*ast.Program, error) {
+	node, err := Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	program, ok := node.(*ast.Program)
+	if !ok {
+		return nil, fmt.Errorf("astjson: expected a Program, got %s", kindOf(node))
+	}
+	return program, nil
+}
+
+// The "kind" of a node - its type name without the package
+func kindOf(node ast.Node) string {
+	return fmt.Sprintf("%T", node)[len("*ast."):]
+}
+
+// encoding/json sorts map keys, which would bury "kind" in the middle of every node - so we keep our own order
+type field struct {
+	key string
+	value interface{}
+}
+type object []field
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(key)
+		out.WriteByte(':')
+		out.Write(value)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
+
+// How tokens, positions and comments look - a position the lexer never filled in is left out
+type jsonPosition struct {
+	Filename string `json:"filename,omitempty"`
+	Line int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+type jsonComment struct {
+	Text string `json:"text"`
+	Start *jsonPosition `json:"start,omitempty"`
+	End *jsonPosition `json:"end,omitempty"`
+}
+type jsonToken struct {
+	Type token.TokenType `json:"type"`
+	Literal string `json:"literal"`
+	Start *jsonPosition `json:"start,omitempty"`
+	End *jsonPosition `json:"end,omitempty"`
+	Leading []jsonComment `json:"leading,omitempty"`
+}
+
+func encodePosition(pos token.Position) *jsonPosition {
+	if !pos.IsValid() {
+		return nil
+	}
+	return &jsonPosition{Filename: pos.Filename, Line: pos.Line, Column: pos.Column, Offset: pos.Offset}
+}
+
+func decodePosition(pos *jsonPosition) token.Position {
+	if pos == nil {
+		return token.Position{}
+	}
+	return token.Position{Filename: pos.Filename, Line: pos.Line, Column: pos.Column, Offset: pos.Offset}
+}
+
+func encodeComments(comments []token.Comment) []jsonComment {
+	if comments == nil {
+		return nil
+	}
+	out := make([]jsonComment, len(comments))
+	for i, c := range comments {
+		out[i] = jsonComment{Text: c.Text, Start: encodePosition(c.Start), End: encodePosition(c.End)}
+	}
+	return out
+}
+
+func decodeComments(comments []jsonComment) []token.Comment {
+	if comments == nil {
+		return nil
+	}
+	out := make([]token.Comment, len(comments))
+	for i, c := range comments {
+		out[i] = token.Comment{Text: c.Text, Start: decodePosition(c.Start), End: decodePosition(c.End)}
+	}
+	return out
+}
+
+func encodeToken(tok token.Token) jsonToken {
+	return jsonToken{
+		Type:    tok.Type,
+		Literal: tok.Literal,
+		Start:   encodePosition(tok.Start),
+		End:     encodePosition(tok.End),
+		Leading: encodeComments(tok.Leading),
+	}
+}
+
+// Turn a node into something encoding/json can write - children are encoded recursively, a missing child becomes null
+func encode(node ast.Node) interface{} {
+	// A nil *ast.Identifier (say) tucked into an ast.Node is still nothing to encode
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return nil
+	}
+
+	o := object{
+		{"kind", kindOf(node)},
+		{"pos", encodePosition(node.Pos())},
+		{"end", encodePosition(node.End())},
+	}
+
+	switch n := node.(type) {
+	case *ast.Program:
+		o = append(o, field{"statements", encodeStatements(n.Statements)})
+		if n.Comments != nil {
+			o = append(o, field{"comments", encodeComments(n.Comments)})
+		}
+
+	case *ast.BadStatement:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"to", encodePosition(n.To)})
+
+	case *ast.LetStatement:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"name", encode(n.Name)}, field{"value", encode(n.Value)})
+
+	case *ast.ReturnStatement:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"returnValue", encode(n.ReturnValue)})
+
+	case *ast.FunctionStatement:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"name", encode(n.Name)}, field{"function", encode(n.Function)})
+
+	case *ast.WhileStatement:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"condition", encode(n.Condition)}, field{"body", encode(n.Body)})
+
+	case *ast.ForStatement:
+		o = append(o,
+			field{"token", encodeToken(n.Token)},
+			field{"init", encode(n.Init)},
+			field{"condition", encode(n.Condition)},
+			field{"post", encode(n.Post)},
+			field{"body", encode(n.Body)},
+		)
+
+	case *ast.BreakStatement:
+		o = append(o, field{"token", encodeToken(n.Token)})
+
+	case *ast.ContinueStatement:
+		o = append(o, field{"token", encodeToken(n.Token)})
+
+	case *ast.ExpressionStatement:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"expression", encode(n.Expression)})
+
+	case *ast.BlockStatement:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"statements", encodeStatements(n.Statements)}, field{"rbrace", encodeToken(n.Rbrace)})
+
+	case *ast.Identifier:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"value", n.Value})
+
+	case *ast.IntegerLiteral:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"value", n.Value})
+
+	case *ast.FloatLiteral:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"value", n.Value})
+
+	case *ast.StringLiteral:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"value", n.Value})
+
+	case *ast.Boolean:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"value", n.Value})
+
+	case *ast.PrefixExpression:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"operator", n.Operator}, field{"right", encode(n.Right)})
+
+	case *ast.InfixExpression:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"left", encode(n.Left)}, field{"operator", n.Operator}, field{"right", encode(n.Right)})
+
+	case *ast.LogicalExpression:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"left", encode(n.Left)}, field{"operator", n.Operator}, field{"right", encode(n.Right)})
+
+	case *ast.AssignExpression:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"target", encode(n.Target)}, field{"operator", n.Operator}, field{"value", encode(n.Value)})
+
+	case *ast.PipeExpression:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"left", encode(n.Left)}, field{"right", encode(n.Right)})
+
+	case *ast.ConditionalExpression:
+		o = append(o,
+			field{"token", encodeToken(n.Token)},
+			field{"condition", encode(n.Condition)},
+			field{"consequence", encode(n.Consequence)},
+			field{"alternative", encode(n.Alternative)},
+		)
+
+	case *ast.IfExpression:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"condition", encode(n.Condition)}, field{"consequence", encode(n.Consequence)})
+		if n.ElseIfs != nil {
+			elseIfs := make([]interface{}, len(n.ElseIfs))
+			for i, ei := range n.ElseIfs {
+				elseIfs[i] = encode(ei)
+			}
+			o = append(o, field{"elseIfs", elseIfs})
+		}
+		o = append(o, field{"alternative", encode(n.Alternative)})
+
+	case *ast.ElseIf:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"condition", encode(n.Condition)}, field{"consequence", encode(n.Consequence)})
+
+	case *ast.FunctionLiteral:
+		parameters := make([]interface{}, len(n.Parameters))
+		for i, p := range n.Parameters {
+			parameters[i] = encode(p)
+		}
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"name", n.Name}, field{"parameters", parameters}, field{"body", encode(n.Body)})
+
+	case *ast.Parameter:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"name", encode(n.Name)}, field{"default", encode(n.Default)}, field{"rest", n.Rest})
+
+	case *ast.CallExpression:
+		o = append(o,
+			field{"token", encodeToken(n.Token)},
+			field{"function", encode(n.Function)},
+			field{"arguments", encodeExpressions(n.Arguments)},
+			field{"rparen", encodeToken(n.Rparen)},
+		)
+
+	case *ast.ArrayLiteral:
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"elements", encodeExpressions(n.Elements)}, field{"rbracket", encodeToken(n.Rbracket)})
+
+	case *ast.IndexExpression:
+		o = append(o,
+			field{"token", encodeToken(n.Token)},
+			field{"left", encode(n.Left)},
+			field{"index", encode(n.Index)},
+			field{"rbracket", encodeToken(n.Rbracket)},
+		)
+
+	case *ast.HashLiteral:
+		pairs := make([]interface{}, len(n.Pairs))
+		for i, pair := range n.Pairs {
+			pairs[i] = object{{"key", encode(pair.Key)}, {"value", encode(pair.Value)}}
+		}
+		o = append(o, field{"token", encodeToken(n.Token)}, field{"pairs", pairs}, field{"rbrace", encodeToken(n.Rbrace)})
+	}
+
+	return o
+}
+
+func encodeStatements(statements []ast.Statement) []interface{} {
+	out := make([]interface{}, len(statements))
+	for i, s := range statements {
+		out[i] = encode(s)
+	}
+	return out
+}
+
+func encodeExpressions(expressions []ast.Expression) []interface{} {
+	out := make([]interface{}, len(expressions))
+	for i, e := range expressions {
+		out[i] = encode(e)
+	}
+	return out
+}
+
+// Holds on to the first thing that went wrong, so the code building each node doesn't have to check after every field
+type decoder struct {
+	err error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("astjson: "+format, a...)
+	}
+}
+
+func isNull(raw json.RawMessage) bool {
+	return len(raw) == 0 || string(raw) == "null"
+}
+
+// Decode a node - null (or a field that isn't there) comes back as nil
+func (d *decoder) node(raw json.RawMessage) ast.Node {
+	if d.err != nil || isNull(raw) {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		d.fail("%s", err)
+		return nil
+	}
+
+	var kind string
+	if err := json.Unmarshal(fields["kind"], &kind); err != nil || kind == "" {
+		d.fail("node without a kind: %s", raw)
+		return nil
+	}
+
+	f := &nodeFields{d: d, kind: kind, fields: fields}
+
+	switch kind {
+	case "Program":
+		var comments []jsonComment
+		f.value("comments", &comments)
+		return &ast.Program{Statements: f.statements("statements"), Comments: decodeComments(comments)}
+
+	case "BadStatement":
+		var to *jsonPosition
+		f.value("to", &to)
+		return &ast.BadStatement{Token: f.token("token"), To: decodePosition(to)}
+
+	case "LetStatement":
+		return &ast.LetStatement{Token: f.token("token"), Name: f.identifier("name"), Value: f.expression("value", true)}
+
+	case "ReturnStatement":
+		return &ast.ReturnStatement{Token: f.token("token"), ReturnValue: f.expression("returnValue", false)}
+
+	case "FunctionStatement":
+		return &ast.FunctionStatement{Token: f.token("token"), Name: f.identifier("name"), Function: f.function("function")}
+
+	case "WhileStatement":
+		return &ast.WhileStatement{Token: f.token("token"), Condition: f.expression("condition", true), Body: f.block("body", true)}
+
+	case "ForStatement":
+		return &ast.ForStatement{
+			Token:     f.token("token"),
+			Init:      f.statement("init", false),
+			Condition: f.expression("condition", false),
+			Post:      f.statement("post", false),
+			Body:      f.block("body", true),
+		}
+
+	case "BreakStatement":
+		return &ast.BreakStatement{Token: f.token("token")}
+
+	case "ContinueStatement":
+		return &ast.ContinueStatement{Token: f.token("token")}
+
+	case "ExpressionStatement":
+		return &ast.ExpressionStatement{Token: f.token("token"), Expression: f.expression("expression", true)}
+
+	case "BlockStatement":
+		return &ast.BlockStatement{Token: f.token("token"), Statements: f.statements("statements"), Rbrace: f.token("rbrace")}
+
+	case "Identifier":
+		n := &ast.Identifier{Token: f.token("token")}
+		f.value("value", &n.Value)
+		return n
+
+	case "IntegerLiteral":
+		n := &ast.IntegerLiteral{Token: f.token("token")}
+		f.value("value", &n.Value)
+		return n
+
+	case "FloatLiteral":
+		n := &ast.FloatLiteral{Token: f.token("token")}
+		f.value("value", &n.Value)
+		return n
+
+	case "StringLiteral":
+		n := &ast.StringLiteral{Token: f.token("token")}
+		f.value("value", &n.Value)
+		return n
+
+	case "Boolean":
+		n := &ast.Boolean{Token: f.token("token")}
+		f.value("value", &n.Value)
+		return n
+
+	case "PrefixExpression":
+		n := &ast.PrefixExpression{Token: f.token("token"), Right: f.expression("right", true)}
+		f.value("operator", &n.Operator)
+		return n
+
+	case "InfixExpression":
+		n := &ast.InfixExpression{Token: f.token("token"), Left: f.expression("left", true), Right: f.expression("right", true)}
+		f.value("operator", &n.Operator)
+		return n
+
+	case "LogicalExpression":
+		n := &ast.LogicalExpression{Token: f.token("token"), Left: f.expression("left", true), Right: f.expression("right", true)}
+		f.value("operator", &n.Operator)
+		return n
+
+	case "AssignExpression":
+		n := &ast.AssignExpression{Token: f.token("token"), Target: f.expression("target", true), Value: f.expression("value", true)}
+		f.value("operator", &n.Operator)
+		return n
+
+	case "PipeExpression":
+		return &ast.PipeExpression{Token: f.token("token"), Left: f.expression("left", true), Right: f.expression("right", true)}
+
+	case "ConditionalExpression":
+		return &ast.ConditionalExpression{
+			Token:       f.token("token"),
+			Condition:   f.expression("condition", true),
+			Consequence: f.expression("consequence", true),
+			Alternative: f.expression("alternative", true),
+		}
+
+	case "IfExpression":
+		n := &ast.IfExpression{
+			Token:       f.token("token"),
+			Condition:   f.expression("condition", true),
+			Consequence: f.block("consequence", true),
+		}
+		for _, raw := range f.list("elseIfs") {
+			elseIf, ok := d.node(raw).(*ast.ElseIf)
+			if !ok {
+				d.fail("IfExpression.elseIfs can only hold ElseIf nodes")
+				return nil
+			}
+			n.ElseIfs = append(n.ElseIfs, elseIf)
+		}
+		n.Alternative = f.block("alternative", false)
+		return n
+
+	case "ElseIf":
+		return &ast.ElseIf{Token: f.token("token"), Condition: f.expression("condition", true), Consequence: f.block("consequence", true)}
+
+	case "FunctionLiteral":
+		n := &ast.FunctionLiteral{Token: f.token("token")}
+		f.value("name", &n.Name)
+		n.Parameters = []*ast.Parameter{}
+		for _, raw := range f.list("parameters") {
+			parameter, ok := d.node(raw).(*ast.Parameter)
+			if !ok {
+				d.fail("FunctionLiteral.parameters can only hold Parameter nodes")
+				return nil
+			}
+			n.Parameters = append(n.Parameters, parameter)
+		}
+		n.Body = f.block("body", true)
+		return n
+
+	case "Parameter":
+		n := &ast.Parameter{Token: f.token("token"), Name: f.identifier("name"), Default: f.expression("default", false)}
+		f.value("rest", &n.Rest)
+		return n
+
+	case "CallExpression":
+		return &ast.CallExpression{
+			Token:     f.token("token"),
+			Function:  f.expression("function", true),
+			Arguments: f.expressions("arguments"),
+			Rparen:    f.token("rparen"),
+		}
+
+	case "ArrayLiteral":
+		return &ast.ArrayLiteral{Token: f.token("token"), Elements: f.expressions("elements"), Rbracket: f.token("rbracket")}
+
+	case "IndexExpression":
+		return &ast.IndexExpression{
+			Token:    f.token("token"),
+			Left:     f.expression("left", true),
+			Index:    f.expression("index", true),
+			Rbracket: f.token("rbracket"),
+		}
+
+	case "HashLiteral":
+		n := &ast.HashLiteral{Token: f.token("token"), Pairs: []ast.HashPair{}, Rbrace: f.token("rbrace")}
+		for _, raw := range f.list("pairs") {
+			var pair map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &pair); err != nil {
+				d.fail("HashLiteral.pairs: %s", err)
+				return nil
+			}
+			p := &nodeFields{d: d, kind: "HashLiteral.pairs", fields: pair}
+			n.Pairs = append(n.Pairs, ast.HashPair{Key: p.expression("key", true), Value: p.expression("value", true)})
+		}
+		return n
+	}
+
+	d.fail("unknown node kind %q", kind)
+	return nil
+}
+
+// The fields of one node, with helpers that decode them into what the node's Go type needs
+type nodeFields struct {
+	d *decoder
+	kind string
+	fields map[string]json.RawMessage
+}
+
+// A plain JSON value - a string, a number or a bool
+func (f *nodeFields) value(key string, v interface{}) {
+	raw, ok := f.fields[key]
+	if !ok || f.d.err != nil {
+		return
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		f.d.fail("%s.%s: %s", f.kind, key, err)
+	}
+}
+
+func (f *nodeFields) token(key string) token.Token {
+	var tok jsonToken
+	f.value(key, &tok)
+	return token.Token{
+		Type:    tok.Type,
+		Literal: tok.Literal,
+		Start:   decodePosition(tok.Start),
+		End:     decodePosition(tok.End),
+		Leading: decodeComments(tok.Leading),
+	}
+}
+
+// A child that may be missing, or has to be there when required is set
+func (f *nodeFields) child(key string, required bool) ast.Node {
+	node := f.d.node(f.fields[key])
+	if node == nil && required {
+		f.d.fail("%s is missing %s", f.kind, key)
+	}
+	return node
+}
+
+func (f *nodeFields) expression(key string, required bool) ast.Expression {
+	node := f.child(key, required)
+	if node == nil {
+		return nil
+	}
+	e, ok := node.(ast.Expression)
+	if !ok {
+		f.d.fail("%s.%s has to be an expression, got %s", f.kind, key, kindOf(node))
+	}
+	return e
+}
+
+func (f *nodeFields) statement(key string, required bool) ast.Statement {
+	node := f.child(key, required)
+	if node == nil {
+		return nil
+	}
+	s, ok := node.(ast.Statement)
+	if !ok {
+		f.d.fail("%s.%s has to be a statement, got %s", f.kind, key, kindOf(node))
+	}
+	return s
+}
+
+func (f *nodeFields) block(key string, required bool) *ast.BlockStatement {
+	node := f.child(key, required)
+	if node == nil {
+		return nil
+	}
+	b, ok := node.(*ast.BlockStatement)
+	if !ok {
+		f.d.fail("%s.%s has to be a BlockStatement, got %s", f.kind, key, kindOf(node))
+	}
+	return b
+}
+
+func (f *nodeFields) identifier(key string) *ast.Identifier {
+	node := f.child(key, true)
+	if node == nil {
+		return nil
+	}
+	i, ok := node.(*ast.Identifier)
+	if !ok {
+		f.d.fail("%s.%s has to be an Identifier, got %s", f.kind, key, kindOf(node))
+	}
+	return i
+}
+
+func (f *nodeFields) function(key string) *ast.FunctionLiteral {
+	node := f.child(key, true)
+	if node == nil {
+		return nil
+	}
+	fl, ok := node.(*ast.FunctionLiteral)
+	if !ok {
+		f.d.fail("%s.%s has to be a FunctionLiteral, got %s", f.kind, key, kindOf(node))
+	}
+	return fl
+}
+
+// The raw elements of an array field - nil if the field isn't there
+func (f *nodeFields) list(key string) []json.RawMessage {
+	var list []json.RawMessage
+	f.value(key, &list)
+	return list
+}
+
+func (f *nodeFields) statements(key string) []ast.Statement {
+	statements := []ast.Statement{}
+	for i, raw := range f.list(key) {
+		s, ok := f.d.node(raw).(ast.Statement)
+		if !ok {
+			f.d.fail("%s.%s[%d] has to be a statement", f.kind, key, i)
+			return nil
+		}
+		statements = append(statements, s)
+	}
+	return statements
+}
+
+func (f *nodeFields) expressions(key string) []ast.Expression {
+	expressions := []ast.Expression{}
+	for i, raw := range f.list(key) {
+		e, ok := f.d.node(raw).(ast.Expression)
+		if !ok {
+			f.d.fail("%s.%s[%d] has to be an expression", f.kind, key, i)
+			return nil
+		}
+		expressions = append(expressions, e)
+	}
+	return expressions
+}
@@ -0,0 +1,263 @@
+package astjson
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, filename string, input string) *ast.Program {
+	p := parser.New(lexer.NewWithFilename(filename, input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v\n%s", p.Errors(), input)
+	}
+	return program
+}
+
+// Something of every node the parser can produce, comments included
+const corpus = `// A comment up front
+let x = 1 + 2 * 3 - 4 / 5 % 6; let y = -x; let z = !true == false;
+let s = "tab\there \"quoted\"";
+let n = 0xFF + 1_000 + 1.5e-3 + 9223372036854775807;
+fn fib(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }
+let add = fn(a, b = 2, ...rest) { a + b };
+let noargs = fn() { };
+let h = {"one": 1, 2: [1, 2, 3], true: fn(x) { x * x }}; let empty = {};
+let r = h["one"] + h[2][0] + [][0];
+if (x > 1) { "big" } else if (x < 0) { "negative" } else { "small" }
+if (x) { } else if (y) { }
+let max = a > b ? a : b;
+let piped = [1, 2] |> map(fn(v) { v * 2 }) |> sum;
+while (x < 10) { x += 1; if (x == 5) { continue } if (x == 8) { break } }
+for (let i = 0; i < 3; i += 1) { y *= 2; } // trailing
+for (;;) { break; }
+a = b = c; h["k"] -= 1; f();
+a && b || !c && (d || e);
+/* the end */
+`
+
+func TestRoundTrip(t *testing.T) {
+	original := parse(t, "corpus.mk", corpus)
+
+	data, err := Marshal(original)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+
+	decoded, err := UnmarshalProgram(data)
+	if err != nil {
+		t.Fatalf("UnmarshalProgram failed: %s", err)
+	}
+
+	// Tokens, positions and comments all come back, so the trees are identical down to the last field
+	if !reflect.DeepEqual(original, decoded) {
+		t.Errorf("decoded program differs from the original.\nbefore: %s\nafter:  %s", original.String(), decoded.String())
+	}
+
+	// And encoding the copy gives the same bytes again
+	again, err := Marshal(decoded)
+	if err != nil {
+		t.Fatalf("Marshal of the decoded program failed: %s", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("re-encoding changed the JSON")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	program := parse(t, "", "let x = -1;")
+
+	data, err := MarshalIndent(program, "", "  ")
+	if err != nil {
+		t.Fatalf("MarshalIndent failed: %s", err)
+	}
+
+	expected := `{
+  "kind": "Program",
+  "pos": {
+    "line": 1,
+    "column": 1,
+    "offset": 0
+  },
+  "end": {
+    "line": 1,
+    "column": 11,
+    "offset": 10
+  },
+  "statements": [
+    {
+      "kind": "LetStatement",
+      "pos": {
+        "line": 1,
+        "column": 1,
+        "offset": 0
+      },
+      "end": {
+        "line": 1,
+        "column": 11,
+        "offset": 10
+      },
+      "token": {
+        "type": "LET",
+        "literal": "let",
+        "start": {
+          "line": 1,
+          "column": 1,
+          "offset": 0
+        },
+        "end": {
+          "line": 1,
+          "column": 4,
+          "offset": 3
+        }
+      },
+      "name": {
+        "kind": "Identifier",
+        "pos": {
+          "line": 1,
+          "column": 5,
+          "offset": 4
+        },
+        "end": {
+          "line": 1,
+          "column": 6,
+          "offset": 5
+        },
+        "token": {
+          "type": "IDENT",
+          "literal": "x",
+          "start": {
+            "line": 1,
+            "column": 5,
+            "offset": 4
+          },
+          "end": {
+            "line": 1,
+            "column": 6,
+            "offset": 5
+          }
+        },
+        "value": "x"
+      },
+      "value": {
+        "kind": "PrefixExpression",
+        "pos": {
+          "line": 1,
+          "column": 9,
+          "offset": 8
+        },
+        "end": {
+          "line": 1,
+          "column": 11,
+          "offset": 10
+        },
+        "token": {
+          "type": "-",
+          "literal": "-",
+          "start": {
+            "line": 1,
+            "column": 9,
+            "offset": 8
+          },
+          "end": {
+            "line": 1,
+            "column": 10,
+            "offset": 9
+          }
+        },
+        "operator": "-",
+        "right": {
+          "kind": "IntegerLiteral",
+          "pos": {
+            "line": 1,
+            "column": 10,
+            "offset": 9
+          },
+          "end": {
+            "line": 1,
+            "column": 11,
+            "offset": 10
+          },
+          "token": {
+            "type": "INT",
+            "literal": "1",
+            "start": {
+              "line": 1,
+              "column": 10,
+              "offset": 9
+            },
+            "end": {
+              "line": 1,
+              "column": 11,
+              "offset": 10
+            }
+          },
+          "value": 1
+        }
+      }
+    }
+  ]
+}`
+
+	if string(data) != expected {
+		t.Errorf("wrong JSON.\nwant:\n%s\ngot:\n%s", expected, data)
+	}
+}
+
+// Nodes made up by hand have no positions, and those are left out rather than written as zeroes
+func TestHandMadeNodes(t *testing.T) {
+	node := &ast.InfixExpression{Left: &ast.Identifier{Value: "a"}, Operator: "+", Right: &ast.IntegerLiteral{Value: 2}}
+
+	data, err := Marshal(node)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	if strings.Contains(string(data), `"line"`) {
+		t.Errorf("positions of a hand-made node were encoded: %s", data)
+	}
+
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	if !reflect.DeepEqual(node, decoded) {
+		t.Errorf("decoded node differs. want %s, got=%s", node.String(), decoded.String())
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind": "Identifier"`, "astjson: unexpected end of JSON input"},
+		{`null`, "astjson: no node in input"},
+		{`{"value": 1}`, `astjson: node without a kind: {"value": 1}`},
+		{`{"kind": "Gadget"}`, `astjson: unknown node kind "Gadget"`},
+		{`{"kind": "LetStatement", "value": {"kind": "Boolean", "value": true}}`, "astjson: LetStatement is missing name"},
+		{`{"kind": "ExpressionStatement", "expression": {"kind": "BreakStatement"}}`, "astjson: ExpressionStatement.expression has to be an expression, got BreakStatement"},
+		{`{"kind": "Program", "statements": [{"kind": "Identifier", "value": "x"}]}`, "astjson: Program.statements[0] has to be a statement"},
+		{`{"kind": "IntegerLiteral", "value": "one"}`, "astjson: IntegerLiteral.value: json: cannot unmarshal string into Go value of type int64"},
+		{`{"kind": "WhileStatement", "condition": {"kind": "Boolean"}, "body": {"kind": "Boolean"}}`, "astjson: WhileStatement.body has to be a BlockStatement, got Boolean"},
+	}
+
+	for _, tt := range tests {
+		_, err := Unmarshal([]byte(tt.input))
+		if err == nil {
+			t.Errorf("expected an error for %s", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %s.\nwant %q\ngot= %q", tt.input, tt.expected, err.Error())
+		}
+	}
+
+	_, err := UnmarshalProgram([]byte(`{"kind": "Identifier", "value": "x"}`))
+	if err == nil || err.Error() != "astjson: expected a Program, got Identifier" {
+		t.Errorf("wrong error for a lone identifier. got=%v", err)
+	}
+}
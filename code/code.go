@@ -0,0 +1,241 @@
+package code
+
+// The bytecode our compiler produces and our virtual machine runs
+// An instruction is a one byte opcode followed by its operands, each of which takes up a fixed number of bytes (big endian)
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+// Disassemble the instructions, one per line, each prefixed with its byte offset
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i += 1
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // Push constants[operand]
+	OpPop // Throw away the top of the stack - emitted after every expression statement
+
+	// Arithmetic and comparison - pop two, push one
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpGreaterThanOrEqual
+	OpLessThan // Not just OpGreaterThan with the operands swapped - they have to be evaluated left to right, since assignments make the order visible
+	OpLessThanOrEqual
+
+	// Prefix operators - pop one, push one
+	OpMinus
+	OpBang
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	// Jumps take an absolute offset into the current instructions
+	OpJumpNotTruthy // Pops the condition
+	OpJump
+	OpJumpIfFalseOrPop // For &&: jump leaving the condition on the stack if it isn't truthy, otherwise pop it
+	OpJumpIfTrueOrPop // For ||: jump leaving the condition on the stack if it is truthy, otherwise pop it
+
+	// A break or continue can come in the middle of an expression, with some of its operands already on the stack - a loop notes
+	// how high the stack was when it started, so they can throw those away before jumping
+	OpLoopEnter
+	OpLoopLeave
+	OpLoopJump // Drop everything pushed since the innermost loop started, then jump like OpJump
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetFree // Load one of the free variables the current closure captured
+	OpSetFree // Store into one of them - the function that declared the variable sees the change, since they share a cell
+	OpGetLocalCell // Push the cell behind a local, putting the local in one first, so a closure can capture the variable rather than its value
+	OpGetFreeCell // Push the cell behind a free variable, so a closure inside this one can capture it in turn
+
+	OpArray // Collect the top operand elements of the stack into an array
+	OpHash // Collect the top operand elements of the stack into a hash - operand counts keys and values separately
+	OpIndex
+	OpSetIndex // Pops a value, an index and a container, stores the value in the container and pushes it back
+	OpDup // Push copies of the top operand elements of the stack, in the same order
+
+	OpCall // Operand is the number of arguments sitting on the stack above the function
+	OpJumpIfArgument // Jump to the second operand if the caller passed an argument for local first operand - skips over a parameter's default value
+	OpReturnValue // Return the top of the stack
+	OpReturn // Return null - for functions whose body doesn't produce a value
+	OpClosure // Wrap constants[first operand] in a closure along with the top second operand free variables
+)
+
+// What an opcode is called and how wide each of its operands is, in bytes
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd:         {"OpAdd", []int{}},
+	OpSub:         {"OpSub", []int{}},
+	OpMul:         {"OpMul", []int{}},
+	OpDiv:                {"OpDiv", []int{}},
+	OpMod:                {"OpMod", []int{}},
+	OpEqual:              {"OpEqual", []int{}},
+	OpNotEqual:           {"OpNotEqual", []int{}},
+	OpGreaterThan:        {"OpGreaterThan", []int{}},
+	OpGreaterThanOrEqual: {"OpGreaterThanOrEqual", []int{}},
+	OpLessThan:           {"OpLessThan", []int{}},
+	OpLessThanOrEqual:    {"OpLessThanOrEqual", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpJumpNotTruthy:    {"OpJumpNotTruthy", []int{2}},
+	OpJump:             {"OpJump", []int{2}},
+	OpJumpIfFalseOrPop: {"OpJumpIfFalseOrPop", []int{2}},
+	OpJumpIfTrueOrPop:  {"OpJumpIfTrueOrPop", []int{2}},
+
+	OpLoopEnter: {"OpLoopEnter", []int{}},
+	OpLoopLeave: {"OpLoopLeave", []int{}},
+	OpLoopJump:  {"OpLoopJump", []int{2}},
+
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpSetFree:        {"OpSetFree", []int{1}},
+	OpGetLocalCell:   {"OpGetLocalCell", []int{1}},
+	OpGetFreeCell:    {"OpGetFreeCell", []int{1}},
+
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpIndex:    {"OpIndex", []int{}},
+	OpSetIndex: {"OpSetIndex", []int{}},
+	OpDup:      {"OpDup", []int{1}},
+
+	OpCall:           {"OpCall", []int{1}},
+	OpJumpIfArgument: {"OpJumpIfArgument", []int{1, 2}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	OpClosure:     {"OpClosure", []int{2, 1}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Encode a single instruction - gives back an empty slice for opcodes we don't know
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// Decode the operands of an instruction - the inverse of Make
+// Also hands back how many bytes we read, so the caller can skip to the next instruction
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
@@ -0,0 +1,857 @@
+package compiler
+
+// The compiler walks the AST once and lowers it to bytecode for the vm package to run
+// Values that can't be encoded in an operand (integers, strings, functions) go into a constant pool and are referred to by index
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+)
+
+// What we remember about the last couple of instructions we emitted, so we can take them back or patch them
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// Every function body gets compiled into its own scope
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+}
+
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	loops []*loopContext // The loops we are in the middle of compiling, innermost last
+}
+
+// The jumps a loop's break and continue statements emitted - we only learn where they should go once the whole loop is compiled
+type loopContext struct {
+	breaks    []int
+	continues []int
+}
+
+// What the compiler hands to the VM
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: NewSymbolTable(),
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// A compiler that carries on from where a previous one left off - the REPL needs this so globals and constants survive from one line to the next
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	switch node := node.(type) {
+
+	// Statements
+	case *ast.Program:
+		err := c.hoistFunctions(node.Statements)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		err := c.Compile(node.Expression)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpPop) // Expression statements leave nothing behind on the stack
+
+	case *ast.BlockStatement:
+		err := c.hoistFunctions(node.Statements)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		// Only define the name once the value is compiled - in let x = x + 1 the x on the right is the old one
+		// A function is the exception: its body only runs once the name is bound, and needs the name to call itself
+		_, isFunction := node.Value.(*ast.FunctionLiteral)
+		var symbol Symbol
+		if isFunction {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
+
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		if !isFunction {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
+
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+
+	case *ast.ReturnStatement:
+		err := c.Compile(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.FunctionStatement:
+		// hoistFunctions() compiled it when the enclosing block started - all that is left is its value, null like in the evaluator,
+		// so a block ending in a declaration doesn't take the value of the statement before it
+		c.emit(code.OpNull)
+		c.emit(code.OpPop)
+
+	case *ast.WhileStatement:
+		c.emit(code.OpLoopEnter)
+		conditionPos := len(c.currentInstructions())
+
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		c.enterLoop()
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		loop := c.leaveLoop()
+
+		c.emit(code.OpJump, conditionPos)
+
+		afterLoopPos := c.emit(code.OpLoopLeave)
+		c.changeOperand(jumpNotTruthyPos, afterLoopPos)
+		c.patchLoopJumps(loop, afterLoopPos, conditionPos)
+		c.emitLoopValue()
+
+	case *ast.ForStatement:
+		if node.Init != nil {
+			err := c.Compile(node.Init)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpLoopEnter)
+		conditionPos := len(c.currentInstructions())
+
+		jumpNotTruthyPos := -1
+		if node.Condition != nil {
+			err := c.Compile(node.Condition)
+			if err != nil {
+				return err
+			}
+			jumpNotTruthyPos = c.emit(code.OpJumpNotTruthy, 9999)
+		}
+
+		c.enterLoop()
+		err := c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		loop := c.leaveLoop()
+
+		// continue skips the rest of the body, but not the post clause
+		postPos := len(c.currentInstructions())
+		if node.Post != nil {
+			err := c.Compile(node.Post)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpJump, conditionPos)
+
+		afterLoopPos := c.emit(code.OpLoopLeave)
+		if jumpNotTruthyPos != -1 {
+			c.changeOperand(jumpNotTruthyPos, afterLoopPos)
+		}
+		c.patchLoopJumps(loop, afterLoopPos, postPos)
+		c.emitLoopValue()
+
+	case *ast.BreakStatement:
+		if len(c.loops) == 0 {
+			return fmt.Errorf("%s: break outside of a loop", node.Pos())
+		}
+		loop := c.loops[len(c.loops)-1]
+		loop.breaks = append(loop.breaks, c.emit(code.OpLoopJump, 9999))
+
+	case *ast.ContinueStatement:
+		if len(c.loops) == 0 {
+			return fmt.Errorf("%s: continue outside of a loop", node.Pos())
+		}
+		loop := c.loops[len(c.loops)-1]
+		loop.continues = append(loop.continues, c.emit(code.OpLoopJump, 9999))
+
+	case *ast.BadStatement:
+		return fmt.Errorf("%s: cannot compile bad statement", node.Pos())
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.PrefixExpression:
+		err := c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "+":
+			c.emit(code.OpAdd)
+		case "-":
+			c.emit(code.OpSub)
+		case "*":
+			c.emit(code.OpMul)
+		case "/":
+			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
+		case ">":
+			c.emit(code.OpGreaterThan)
+		case ">=":
+			c.emit(code.OpGreaterThanOrEqual)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "<=":
+			c.emit(code.OpLessThanOrEqual)
+		case "==":
+			c.emit(code.OpEqual)
+		case "!=":
+			c.emit(code.OpNotEqual)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.AssignExpression:
+		err := c.compileAssignExpression(node)
+		if err != nil {
+			return err
+		}
+
+	case *ast.LogicalExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		// If the left side already decides the answer it stays on the stack as the result, otherwise it makes way for the right side
+		var jumpPos int
+		switch node.Operator {
+		case "&&":
+			jumpPos = c.emit(code.OpJumpIfFalseOrPop, 9999)
+		case "||":
+			jumpPos = c.emit(code.OpJumpIfTrueOrPop, 9999)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	case *ast.IfExpression:
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		// Emit with a bogus offset - we patch it once we know where the consequence ends
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		err = c.compileBlockValue(node.Consequence)
+		if err != nil {
+			return err
+		}
+
+		// Every branch that runs jumps past the rest of the chain, so we patch them all at the very end
+		jumpPositions := []int{c.emit(code.OpJump, 9999)}
+
+		afterConsequencePos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+
+		for _, ei := range node.ElseIfs {
+			err := c.Compile(ei.Condition)
+			if err != nil {
+				return err
+			}
+
+			jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+			err = c.compileBlockValue(ei.Consequence)
+			if err != nil {
+				return err
+			}
+
+			jumpPositions = append(jumpPositions, c.emit(code.OpJump, 9999))
+			c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+		}
+
+		// An if is an expression, so even without an else branch something has to end up on the stack
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else {
+			err := c.compileBlockValue(node.Alternative)
+			if err != nil {
+				return err
+			}
+		}
+
+		afterAlternativePos := len(c.currentInstructions())
+		for _, pos := range jumpPositions {
+			c.changeOperand(pos, afterAlternativePos)
+		}
+
+	case *ast.ConditionalExpression:
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		err = c.Compile(node.Consequence)
+		if err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		err = c.Compile(node.Alternative)
+		if err != nil {
+			return err
+		}
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("identifier not found: %s", node.Value)
+		}
+
+		c.loadSymbol(symbol)
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		// Keys and values go on the stack in pairs, in the order they were written
+		for _, pair := range node.Pairs {
+			err := c.Compile(pair.Key)
+			if err != nil {
+				return err
+			}
+			err = c.Compile(pair.Value)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Index)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpIndex)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+
+	case *ast.PipeExpression:
+		return c.Compile(node.Call())
+
+	case *ast.CallExpression:
+		err := c.Compile(node.Function)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
+
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+// An assignment leaves the value it stored on the stack, since it is an expression like any other
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	op := node.BinaryOperator()
+
+	var binaryOp code.Opcode
+	switch op {
+	case "":
+	case "+":
+		binaryOp = code.OpAdd
+	case "-":
+		binaryOp = code.OpSub
+	case "*":
+		binaryOp = code.OpMul
+	case "/":
+		binaryOp = code.OpDiv
+	default:
+		return fmt.Errorf("unknown operator %s", node.Operator)
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(target.Value)
+		if !ok {
+			return fmt.Errorf("identifier not found: %s", target.Value)
+		}
+
+		if op != "" {
+			c.loadSymbol(symbol)
+		}
+
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		if op != "" {
+			c.emit(binaryOp)
+		}
+
+		switch symbol.Scope {
+		case GlobalScope:
+			c.emit(code.OpSetGlobal, symbol.Index)
+		case LocalScope:
+			c.emit(code.OpSetLocal, symbol.Index)
+		case FreeScope:
+			c.emit(code.OpSetFree, symbol.Index)
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.IndexExpression:
+		err := c.Compile(target.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(target.Index)
+		if err != nil {
+			return err
+		}
+
+		// Read the current value without evaluating the container and the index a second time
+		if op != "" {
+			c.emit(code.OpDup, 2)
+			c.emit(code.OpIndex)
+		}
+
+		err = c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		if op != "" {
+			c.emit(binaryOp)
+		}
+
+		c.emit(code.OpSetIndex)
+
+	default:
+		return fmt.Errorf("cannot assign to %s", node.Target.String())
+	}
+
+	return nil
+}
+
+// Compile the body of an if/else branch so it leaves exactly one value on the stack - the value of its last expression, or null
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull) // Empty, or ends in a let or a return
+	}
+
+	return nil
+}
+
+// Bind every function declared in a block before any of the block runs, so they can call each other whatever order they are written in
+// Inside a function that works because a closure captures the cell behind a local rather than its value - a declaration can capture
+// one declared after it, and sees the closure once it is stored there
+func (c *Compiler) hoistFunctions(statements []ast.Statement) error {
+	var declarations []*ast.FunctionStatement
+	for _, s := range statements {
+		if fs, ok := s.(*ast.FunctionStatement); ok {
+			declarations = append(declarations, fs)
+		}
+	}
+	if len(declarations) == 0 {
+		return nil
+	}
+
+	symbols := make([]Symbol, len(declarations))
+	declared := map[string]bool{}
+	for i, fs := range declarations {
+		symbols[i] = c.symbolTable.Define(fs.Name.Value)
+		declared[fs.Name.Value] = true
+	}
+
+	// The bodies can use the block's let bindings as well, so those need their slots before the bodies are compiled
+	for _, s := range statements {
+		if ls, ok := s.(*ast.LetStatement); ok && !declared[ls.Name.Value] {
+			c.symbolTable.DefineEarly(ls.Name.Value)
+		}
+	}
+
+	for i, fs := range declarations {
+		err := c.compileFunctionLiteral(fs.Function)
+		if err != nil {
+			return err
+		}
+
+		if symbols[i].Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbols[i].Index)
+		} else {
+			c.emit(code.OpSetLocal, symbols[i].Index)
+		}
+	}
+	c.symbolTable.HideEarly()
+
+	return nil
+}
+
+// Compile a function literal into its own scope
+// Its body calls itself through the variable it is bound to, like any other - the let or declaration defines that first
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope()
+
+	// The loops around the literal are in another function's instructions - a break in here can't jump to them
+	loops := c.loops
+	c.loops = nil
+
+	numParameters, numRequired, variadic := 0, 0, false
+	for _, p := range node.Parameters {
+		symbol := c.symbolTable.Define(p.Name.Value)
+
+		switch {
+		case p.Rest:
+			variadic = true
+			continue
+		case p.Default == nil:
+			numRequired += 1
+		default:
+			// The VM leaves the slot of a missing argument empty - fill in the default unless there is something there
+			// The later parameters aren't defined yet, so a default can only refer to the ones before it
+			jumpPos := c.emit(code.OpJumpIfArgument, symbol.Index, 9999)
+			err := c.Compile(p.Default)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpSetLocal, symbol.Index)
+			c.replaceInstruction(jumpPos, code.Make(code.OpJumpIfArgument, symbol.Index, len(c.currentInstructions())))
+		}
+		numParameters += 1
+	}
+
+	err := c.Compile(node.Body)
+	if err != nil {
+		return err
+	}
+
+	// The value of the last expression statement is the return value
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	instructions := c.leaveScope()
+	c.loops = loops
+
+	// Load whatever the closure captures, so OpClosure can take it off the stack
+	for _, s := range freeSymbols {
+		c.captureSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: numParameters,
+		NumRequired:   numRequired,
+		Variadic:      variadic,
+		Name:          node.Name,
+	}
+
+	fnIndex := c.addConstant(compiledFn)
+	c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	}
+}
+
+// Like loadSymbol, but a closure shares the variables it captures with the function they belong to, so it gets their cells
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpGetLocalCell, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFreeCell, s.Index)
+	}
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+	}
+}
+
+// Put a value in the constant pool and hand back its index
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// Encode an instruction, add it to the current scope and hand back where it starts
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
+
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	old := c.currentInstructions()
+	new := old[:last.Position]
+
+	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+// Patch the operand of an instruction we already emitted - only safe because the opcode (and so its width) stays the same
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterLoop() {
+	c.loops = append(c.loops, &loopContext{})
+}
+
+func (c *Compiler) leaveLoop() *loopContext {
+	loop := c.loops[len(c.loops)-1]
+	c.loops = c.loops[:len(c.loops)-1]
+
+	return loop
+}
+
+// A loop is a statement, but like the evaluator we give it the value null - so a program, block or function body that ends
+// in a loop is null, rather than whatever the last expression inside the body happened to be
+func (c *Compiler) emitLoopValue() {
+	c.emit(code.OpNull)
+	c.emit(code.OpPop)
+}
+
+// Point every break of the loop at breakPos and every continue at continuePos
+func (c *Compiler) patchLoopJumps(loop *loopContext, breakPos, continuePos int) {
+	for _, pos := range loop.breaks {
+		c.changeOperand(pos, breakPos)
+	}
+	for _, pos := range loop.continues {
+		c.changeOperand(pos, continuePos)
+	}
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
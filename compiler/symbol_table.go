@@ -0,0 +1,125 @@
+package compiler
+
+// The symbol table tells the compiler where a name lives at runtime, so it can emit the right Get/Set instruction for it
+
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL" // Top level let bindings - the VM keeps these in its globals store
+	LocalScope  SymbolScope = "LOCAL" // Parameters and let bindings inside a function - these live on the stack
+	FreeScope   SymbolScope = "FREE" // Locals of an enclosing function, captured by a closure
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable // The table of the enclosing function, nil at the top level
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	early  map[string]Symbol // Let bindings defined ahead of their statement for hoisted functions, and what the names meant before
+	hidden map[string]Symbol // Slots handed out ahead of a let that the rest of the block can't see yet - Define gives them out again
+
+	FreeSymbols []Symbol // The enclosing scopes' symbols this function captures, in the order the closure will hold them
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	free := []Symbol{}
+	return &SymbolTable{store: s, FreeSymbols: free}
+}
+
+// A table for a function body nested inside the given one
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Give a name the next free slot in this scope - binding a name that already has a slot here reuses it
+func (s *SymbolTable) Define(name string) Symbol {
+	if hidden, ok := s.hidden[name]; ok {
+		delete(s.hidden, name)
+		s.store[name] = hidden
+		return hidden
+	}
+	if existing, ok := s.store[name]; ok && (existing.Scope == GlobalScope || existing.Scope == LocalScope) {
+		return existing
+	}
+
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// Define a let binding ahead of its statement, so the functions hoisted above it can use it
+func (s *SymbolTable) DefineEarly(name string) Symbol {
+	if _, ok := s.early[name]; !ok {
+		if s.early == nil {
+			s.early = map[string]Symbol{}
+		}
+		s.early[name] = s.store[name] // The zero Symbol if the name meant nothing here
+	}
+	return s.Define(name)
+}
+
+// Once the hoisted functions are compiled, the names defined early go back to what they meant before, until their let statements
+// Define them for real - in let x = x + 1 the x on the right is still the old one
+func (s *SymbolTable) HideEarly() {
+	for name, previous := range s.early {
+		if s.hidden == nil {
+			s.hidden = map[string]Symbol{}
+		}
+		s.hidden[name] = s.store[name]
+
+		if previous.Name == "" {
+			delete(s.store, name)
+		} else {
+			s.store[name] = previous
+		}
+	}
+	s.early = nil
+}
+
+// Turn a local of an enclosing function into a free variable of this one
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol.Scope = FreeScope
+
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Look a name up here and then in each enclosing table
+// Globals are reachable from anywhere, but anything local to an enclosing function has to be captured as a free variable on the way back in
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		obj, ok = s.Outer.Resolve(name)
+		if !ok {
+			return obj, ok
+		}
+
+		if obj.Scope == GlobalScope {
+			return obj, ok
+		}
+
+		free := s.defineFree(obj)
+		return free, true
+	}
+	return obj, ok
+}
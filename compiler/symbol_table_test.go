@@ -0,0 +1,108 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1},
+		"c": {Name: "c", Scope: LocalScope, Index: 0},
+		"d": {Name: "d", Scope: LocalScope, Index: 1},
+	}
+
+	global := NewSymbolTable()
+
+	a := global.Define("a")
+	if a != expected["a"] {
+		t.Errorf("expected a=%+v, got=%+v", expected["a"], a)
+	}
+
+	b := global.Define("b")
+	if b != expected["b"] {
+		t.Errorf("expected b=%+v, got=%+v", expected["b"], b)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+
+	c := local.Define("c")
+	if c != expected["c"] {
+		t.Errorf("expected c=%+v, got=%+v", expected["c"], c)
+	}
+
+	d := local.Define("d")
+	if d != expected["d"] {
+		t.Errorf("expected d=%+v, got=%+v", expected["d"], d)
+	}
+
+	// Defining a name again keeps its slot
+	again := global.Define("a")
+	if again != expected["a"] {
+		t.Errorf("expected a=%+v, got=%+v", expected["a"], again)
+	}
+}
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "c", Scope: FreeScope, Index: 0},
+		{Name: "e", Scope: LocalScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := secondLocal.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	if len(secondLocal.FreeSymbols) != 1 || secondLocal.FreeSymbols[0].Name != "c" {
+		t.Errorf("wrong free symbols. got=%+v", secondLocal.FreeSymbols)
+	}
+
+	if _, ok := secondLocal.Resolve("nope"); ok {
+		t.Errorf("name nope resolved, but was never defined")
+	}
+}
+
+func TestDefineEarly(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("x")
+
+	local := NewEnclosedSymbolTable(global)
+	early := local.DefineEarly("x")
+	expected := Symbol{Name: "x", Scope: LocalScope, Index: 0}
+	if early != expected {
+		t.Errorf("expected x=%+v, got=%+v", expected, early)
+	}
+
+	// Hidden again, x is the global until it is defined for real - and then it gets the slot it had early
+	local.HideEarly()
+
+	result, ok := local.Resolve("x")
+	if !ok || result.Scope != GlobalScope {
+		t.Errorf("expected x to resolve to the global, got=%+v", result)
+	}
+
+	defined := local.Define("x")
+	if defined != expected {
+		t.Errorf("expected x=%+v, got=%+v", expected, defined)
+	}
+
+	result, _ = local.Resolve("x")
+	if result != expected {
+		t.Errorf("expected x to resolve to %+v, got=%+v", expected, result)
+	}
+}
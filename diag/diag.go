@@ -0,0 +1,124 @@
+package diag
+
+// Diagnostics are the structured form of the errors our lexer and parser report
+// Instead of just a message, they carry enough information for a tool to find out what went wrong and where without picking the message apart
+
+import (
+	"bytes"
+	"monkey/token"
+	"strings"
+)
+
+// How bad is it?
+type Severity int
+
+const (
+	Error Severity = iota // The input is not a valid program
+	Warning // The input is valid, but probably not what the author meant
+	Info // Just letting you know
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Info:
+		return "info"
+	}
+	return "unknown"
+}
+
+// A stable identifier for each kind of problem - tools should match on these rather than on messages
+type Code string
+
+const (
+	UnexpectedToken	Code = "unexpected-token" // We needed one kind of token and got another
+	NoPrefixParseFn	Code = "no-prefix-parse-fn" // A token showed up where an expression should start, but it can't start one
+	InvalidInteger	Code = "invalid-integer" // An INT token whose literal strconv could not make sense of
+	InvalidParameter	Code = "invalid-parameter" // A parameter list that breaks the rules - a required parameter after a defaulted one, or something after ...rest
+	DuplicateParameter	Code = "duplicate-parameter" // The same name used for two parameters of one function
+	InvalidAssignmentTarget	Code = "invalid-assignment-target" // Something on the left of = that can't be assigned to, like 1 or f()
+	LoopControlOutsideLoop	Code = "loop-control-outside-loop" // A break or continue that isn't inside the body of a loop
+	IntegerOverflow	Code = "integer-overflow" // An INT token too big to fit in an int64
+	InvalidFloat	Code = "invalid-float" // A FLOAT token whose literal strconv could not make sense of, like 1.2.3
+
+	// Reported by the lexer
+	IllegalCharacter	Code = "illegal-character" // A character that can't start any token
+	InvalidUTF8	Code = "invalid-utf8" // Bytes in the input that don't decode as UTF-8
+	UnterminatedString	Code = "unterminated-string" // A string literal that runs into the end of the input
+	InvalidEscape	Code = "invalid-escape" // A backslash escape we don't know, or a malformed \u{...}
+	UnterminatedComment	Code = "unterminated-comment" // A /* comment that runs into the end of the input
+	ReadError	Code = "read-error" // The reader the source came from failed - everything after that point is missing
+)
+
+// The stretch of source a diagnostic is talking about - End points just past the last character
+type Span struct {
+	Start token.Position
+	End   token.Position
+}
+
+// The span covered by a single token
+func TokenSpan(tok token.Token) Span {
+	return Span{Start: tok.Start, End: tok.End}
+}
+
+// A suggested edit that would make the problem go away - replace whatever is in Span with NewText
+// An empty span (Start == End) means "insert NewText here"
+type Fix struct {
+	Message string
+	Span    Span
+	NewText string
+}
+
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Message  string // Human readable, without the position - String() adds that
+	Span     Span
+	Expected []token.TokenType // Token types that would have been accepted here, if we know them
+	Actual   token.TokenType // The token type we actually found, if that is what went wrong
+	Fixes    []Fix // Optional hints on how to repair the input
+}
+
+// Formatted the way our parser errors always have been: "line:column: message"
+func (d Diagnostic) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(d.Span.Start.String())
+	out.WriteString(": ")
+	out.WriteString(d.Message)
+
+	return out.String()
+}
+
+// So a diagnostic can be handed around as a Go error
+func (d Diagnostic) Error() string { return d.String() }
+
+// Render the diagnostic along with its code, severity and fix hints - handy for command line tools
+func (d Diagnostic) Verbose() string {
+	var out bytes.Buffer
+
+	out.WriteString(d.Span.Start.String())
+	out.WriteString(": " + d.Severity.String())
+	out.WriteString("[" + string(d.Code) + "]: ")
+	out.WriteString(d.Message)
+
+	if len(d.Expected) > 0 {
+		expected := []string{}
+		for _, t := range d.Expected {
+			expected = append(expected, string(t))
+		}
+		out.WriteString("\n\texpected: " + strings.Join(expected, " or "))
+		if d.Actual != "" {
+			out.WriteString(", found: " + string(d.Actual))
+		}
+	}
+
+	for _, f := range d.Fixes {
+		out.WriteString("\n\thint: " + f.Message)
+	}
+
+	return out.String()
+}
@@ -0,0 +1,34 @@
+package diag
+
+import (
+	"monkey/token"
+	"testing"
+)
+
+func TestDiagnosticString(t *testing.T) {
+	d := Diagnostic{
+		Severity: Error,
+		Code:     UnexpectedToken,
+		Message:  "expected next token to be ), got ; instead",
+		Span: Span{
+			Start: token.Position{Line: 2, Column: 7, Offset: 12},
+			End:   token.Position{Line: 2, Column: 8, Offset: 13},
+		},
+		Expected: []token.TokenType{token.RPAREN},
+		Actual:   token.SEMICOLON,
+		Fixes: []Fix{
+			{Message: "insert )", NewText: ")"},
+		},
+	}
+
+	if d.String() != "2:7: expected next token to be ), got ; instead" {
+		t.Errorf("d.String() wrong. got=%q", d.String())
+	}
+
+	expected := "2:7: error[unexpected-token]: expected next token to be ), got ; instead\n" +
+		"\texpected: ), found: ;\n" +
+		"\thint: insert )"
+	if d.Verbose() != expected {
+		t.Errorf("d.Verbose() wrong. expected=%q, got=%q", expected, d.Verbose())
+	}
+}
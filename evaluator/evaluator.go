@@ -0,0 +1,798 @@
+package evaluator
+
+// A tree-walking interpreter - we recursively walk the AST the parser gave us and compute a value for each node as we go
+
+import (
+	"fmt"
+	"math"
+	"monkey/ast"
+	"monkey/object"
+)
+
+// There is only ever one true, one false and one null (and one break and one continue), so we don't keep allocating new ones
+var (
+	NULL		= &object.Null{}
+	TRUE		= &object.Boolean{Value: true}
+	FALSE		= &object.Boolean{Value: false}
+	BREAK		= &object.Break{}
+	CONTINUE	= &object.Continue{}
+)
+
+// Evaluate the given node in the given environment
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+
+	// Statements
+	case *ast.Program:
+		return evalProgram(node, env)
+
+	case *ast.ExpressionStatement:
+		return Eval(node.Expression, env)
+
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, env)
+
+	case *ast.ReturnStatement:
+		val := Eval(node.ReturnValue, env)
+		if isAbrupt(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	case *ast.FunctionStatement:
+		// hoistFunctions() already bound it when the enclosing block started - as a statement it is null, like a loop
+		return NULL
+
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
+	case *ast.BadStatement:
+		return newError("cannot evaluate bad statement at %s", node.Pos())
+
+	case *ast.LetStatement:
+		val := Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		env.Set(node.Name.Value, val)
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isAbrupt(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+
+	case *ast.PrefixExpression:
+		right := Eval(node.Right, env)
+		if isAbrupt(right) {
+			return right
+		}
+		return evalPrefixExpression(node.Operator, right)
+
+	case *ast.InfixExpression:
+		left := Eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		right := Eval(node.Right, env)
+		if isAbrupt(right) {
+			return right
+		}
+		return evalInfixExpression(node.Operator, left, right)
+
+	case *ast.LogicalExpression:
+		return evalLogicalExpression(node, env)
+
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+
+	case *ast.IfExpression:
+		return evalIfExpression(node, env)
+
+	case *ast.ConditionalExpression:
+		return evalConditionalExpression(node, env)
+
+	case *ast.PipeExpression:
+		return Eval(node.Call(), env)
+
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+
+	case *ast.FunctionLiteral:
+		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env, Name: node.Name}
+
+	case *ast.CallExpression:
+		function := Eval(node.Function, env)
+		if isAbrupt(function) {
+			return function
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isAbrupt(args[0]) {
+			return args[0]
+		}
+		return applyFunction(function, args)
+	}
+
+	return nil
+}
+
+// Evaluate each statement in turn - the value of the program is the value of the last statement
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+
+	hoistFunctions(program.Statements, env)
+
+	for _, statement := range program.Statements {
+		result = Eval(statement, env)
+
+		// A return at the top level ends the program, and we unwrap the value since nobody else will
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+
+	return result
+}
+
+// Like evalProgram, but we do NOT unwrap return values - the enclosing block (or function call) needs to see them so it stops too
+func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	hoistFunctions(block.Statements, env)
+
+	for _, statement := range block.Statements {
+		result = Eval(statement, env)
+
+		if isAbrupt(result) {
+			return result
+		}
+	}
+
+	// An empty block (or one ending in a let) still has to produce something - callers may well use it as a value
+	if result == nil {
+		return NULL
+	}
+
+	return result
+}
+
+// Loops are statements, but a program or block that ends in one still gets a value - always null, in both engines
+// Monkey has no block scope, so the loop runs in the enclosing environment - a let in its body or its init clause outlives it
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		result := Eval(ws.Body, env)
+		if stop, result := loopBodyResult(result); stop {
+			return result
+		}
+	}
+}
+
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	if fs.Init != nil {
+		init := Eval(fs.Init, env)
+		if isAbrupt(init) {
+			return init
+		}
+	}
+
+	for {
+		if fs.Condition != nil {
+			condition := Eval(fs.Condition, env)
+			if isAbrupt(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return NULL
+			}
+		}
+
+		result := Eval(fs.Body, env)
+		if stop, result := loopBodyResult(result); stop {
+			return result
+		}
+
+		if fs.Post != nil {
+			post := Eval(fs.Post, env)
+			if isAbrupt(post) {
+				return post
+			}
+		}
+	}
+}
+
+// Whether a loop should stop after its body produced the given result, and what the loop itself then produces
+// A break is used up by the loop, while errors and return values carry on outwards
+func loopBodyResult(result object.Object) (bool, object.Object) {
+	if result == nil {
+		return false, nil
+	}
+
+	switch result.Type() {
+	case object.BREAK_OBJ:
+		return true, NULL
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return true, result
+	}
+
+	return false, nil // Includes continue - we simply go round again
+}
+
+// Bind every function declared in a block before any of the block runs, so they can call each other whatever order they are written in
+func hoistFunctions(statements []ast.Statement, env *object.Environment) {
+	for _, statement := range statements {
+		if fs, ok := statement.(*ast.FunctionStatement); ok {
+			env.Set(fs.Name.Value, Eval(fs.Function, env))
+		}
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+func evalPrefixExpression(operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return evalBangOperatorExpression(right)
+	case "-":
+		return evalMinusPrefixOperatorExpression(right)
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+// !x is true exactly when x is not truthy
+func evalBangOperatorExpression(right object.Object) object.Object {
+	return nativeBoolToBooleanObject(!isTruthy(right))
+}
+
+func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	if right.Type() == object.FLOAT_OBJ {
+		return &object.Float{Value: -right.(*object.Float).Value}
+	}
+
+	if right.Type() != object.INTEGER_OBJ {
+		return newError("unknown operator: -%s", right.Type())
+	}
+
+	value := right.(*object.Integer).Value
+	return &object.Integer{Value: -value}
+}
+
+func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right): // At least one of them is a float, so the integer gets promoted
+		return evalFloatInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
+	// Booleans (and null) are singletons, so comparing the pointers is comparing the values
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+
+	switch operator {
+	case "+":
+		return &object.Integer{Value: leftVal + rightVal}
+	case "-":
+		return &object.Integer{Value: leftVal - rightVal}
+	case "*":
+		return &object.Integer{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("modulo by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// && and || short-circuit, and hand back whichever operand decided the result rather than a fresh boolean
+func evalLogicalExpression(node *ast.LogicalExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+
+	switch node.Operator {
+	case "&&":
+		if !isTruthy(left) {
+			return left
+		}
+	case "||":
+		if isTruthy(left) {
+			return left
+		}
+	default:
+		return newError("unknown operator: %s %s", left.Type(), node.Operator)
+	}
+
+	return Eval(node.Right, env)
+}
+
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("modulo by zero")
+		}
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// Only call this on something isNumber() said yes to
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+// An assignment evaluates to the value that was stored, so x = y = 1 works
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		// Left to right, like the VM: in x += (x = 10) the x on the left is read before the right side runs
+		var current object.Object
+		op := node.BinaryOperator()
+		if op != "" {
+			current = evalIdentifier(target, env)
+			if isAbrupt(current) {
+				return current
+			}
+		}
+
+		val := Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+
+		if op != "" {
+			val = evalInfixExpression(op, current, val)
+			if isAbrupt(val) {
+				return val
+			}
+		}
+
+		if !env.Assign(target.Value, val) {
+			return newError("identifier not found: %s", target.Value)
+		}
+		return val
+
+	case *ast.IndexExpression:
+		// The container and the index are only evaluated once, even for arr[f()] += 1
+		left := Eval(target.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+
+		var current object.Object
+		op := node.BinaryOperator()
+		if op != "" {
+			current = evalIndexExpression(left, index)
+			if isAbrupt(current) {
+				return current
+			}
+		}
+
+		val := Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+
+		if op != "" {
+			val = evalInfixExpression(op, current, val)
+			if isAbrupt(val) {
+				return val
+			}
+		}
+
+		return evalIndexAssignment(left, index, val)
+
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+}
+
+// Arrays and hashes are changed in place - everything else holding on to them sees the new value too
+func evalIndexAssignment(left, index, val object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		array := left.(*object.Array)
+		idx := index.(*object.Integer).Value
+		if idx < 0 || idx >= int64(len(array.Elements)) {
+			return newError("index out of range: %d, array has %d elements", idx, len(array.Elements))
+		}
+		array.Elements[idx] = val
+		return val
+	case left.Type() == object.HASH_OBJ:
+		hashKey, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.(*object.Hash).Pairs[hashKey.HashKey()] = object.HashPair{Key: index, Value: val}
+		return val
+	default:
+		return newError("index assignment not supported: %s[%s]", left.Type(), index.Type())
+	}
+}
+
+// Strings can be glued together and compared by value
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	default:
+		return newError("index operator not supported: %s[%s]", left.Type(), index.Type())
+	}
+}
+
+// Indexing past either end of an array gives null rather than an error
+func evalArrayIndexExpression(array, index object.Object) object.Object {
+	arrayObject := array.(*object.Array)
+	idx := index.(*object.Integer).Value
+	max := int64(len(arrayObject.Elements) - 1)
+
+	if idx < 0 || idx > max {
+		return NULL
+	}
+
+	return arrayObject.Elements[idx]
+}
+
+// Keys and values are evaluated in the order they were written
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isAbrupt(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := Eval(pair.Value, env)
+		if isAbrupt(value) {
+			return value
+		}
+
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+// Looking up a key that isn't there gives null
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return NULL
+	}
+
+	return pair.Value
+}
+
+func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := Eval(ie.Condition, env)
+	if isAbrupt(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return Eval(ie.Consequence, env)
+	}
+
+	for _, ei := range ie.ElseIfs {
+		condition := Eval(ei.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if isTruthy(condition) {
+			return Eval(ei.Consequence, env)
+		}
+	}
+
+	if ie.Alternative != nil {
+		return Eval(ie.Alternative, env)
+	} else {
+		return NULL
+	}
+}
+
+func evalConditionalExpression(ce *ast.ConditionalExpression, env *object.Environment) object.Object {
+	condition := Eval(ce.Condition, env)
+	if isAbrupt(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return Eval(ce.Consequence, env)
+	}
+	return Eval(ce.Alternative, env)
+}
+
+// Everything except null and false counts as true - including 0
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	val, ok := env.Get(node.Value)
+	if !ok {
+		return newError("identifier not found: %s", node.Value)
+	}
+	return val
+}
+
+// Evaluate the expressions left to right - if one of them errors, that error is the only thing we return
+func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		evaluated := Eval(e, env)
+		if isAbrupt(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+func applyFunction(fn object.Object, args []object.Object) object.Object {
+	function, ok := fn.(*object.Function)
+	if !ok {
+		return newError("not a function: %s", fn.Type())
+	}
+
+	required, max := arity(function.Parameters)
+	if len(args) < required || max != -1 && len(args) > max {
+		return newError("wrong number of arguments: want=%s, got=%d", wantArguments(required, max), len(args))
+	}
+
+	extendedEnv, err := extendFunctionEnv(function, args)
+	if err != nil {
+		return err
+	}
+	evaluated := Eval(function.Body, extendedEnv)
+	return unwrapReturnValue(evaluated)
+}
+
+// How many arguments a function needs at least, and how many it takes at most - -1 when a rest parameter takes any number
+func arity(params []*ast.Parameter) (int, int) {
+	required := 0
+	for _, param := range params {
+		if param.Rest {
+			return required, -1
+		}
+		if param.Default == nil {
+			required += 1
+		}
+	}
+	return required, len(params)
+}
+
+// Describe the number of arguments a function wants, for error messages - 2, 1..3 or 1+
+func wantArguments(required, max int) string {
+	switch {
+	case max == -1:
+		return fmt.Sprintf("%d+", required)
+	case required != max:
+		return fmt.Sprintf("%d..%d", required, max)
+	default:
+		return fmt.Sprintf("%d", required)
+	}
+}
+
+// The function body runs in a new environment enclosed by the one the function was DEFINED in (not the one it is called from) - that's a closure
+// Defaults are evaluated at call time in that new environment, one parameter at a time, so they can refer to the parameters before them
+func extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, *object.Error) {
+	env := object.NewEnclosedEnvironment(fn.Env)
+
+	for paramIdx, param := range fn.Parameters {
+		switch {
+		case param.Rest:
+			rest := []object.Object{}
+			if paramIdx < len(args) {
+				rest = append(rest, args[paramIdx:]...)
+			}
+			env.Set(param.Name.Value, &object.Array{Elements: rest})
+		case paramIdx < len(args):
+			env.Set(param.Name.Value, args[paramIdx])
+		default:
+			val := Eval(param.Default, env)
+			if isError(val) {
+				return nil, val.(*object.Error)
+			}
+			env.Set(param.Name.Value, val)
+		}
+	}
+
+	return env, nil
+}
+
+// A return statement inside a function only returns from that function - so it must not keep bubbling up through the caller
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+	return obj
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	}
+	return false
+}
+
+// Errors, and the return, break or continue that cut a block short, stop whatever expression they turn up in and are handed on upwards untouched
+// So let y = if (c) { break } else { 1 } ends the loop instead of binding the break to y
+func isAbrupt(obj object.Object) bool {
+	if obj != nil {
+		switch obj.Type() {
+		case object.ERROR_OBJ, object.RETURN_VALUE_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+			return true
+		}
+	}
+	return false
+}
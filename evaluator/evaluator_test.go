@@ -0,0 +1,963 @@
+package evaluator
+
+import (
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"10 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 + 10 % 4 * 3", 8},
+		{"0 || 5", 0},
+		{"5 && 7", 7},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 < 2) { }", nil},
+		{"if (false) { 10 } else if (true) { 20 } else { 30 }", 20},
+		{"if (false) { 10 } else if (false) { 20 } else { 30 }", 30},
+		{"if (false) { 10 } else if (false) { 20 }", nil},
+		{"let x = 5; if (x < 0) { 1 } else if (x < 3) { 2 } else if (x < 10) { 3 } else { 4 }", 3},
+		// Only the first matching branch runs
+		{"let n = 0; if (true) { n += 1 } else if (n += 10) { n += 100 }; n", 1},
+		// A continue in a later condition ends the iteration instead of counting as true
+		{"let n = 0; let i = 0; while (i < 3) { i += 1; if (false) { 1 } else if (if (true) { continue } else { false }) { n += 1 } }; n", 0},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestConditionalExpressions(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	interface{}
+	}{
+		{"true ? 1 : 2", 1},
+		{"false ? 1 : 2", 2},
+		{"0 ? 1 : 2", 1},
+		{"1 > 2 ? 10 : 1 < 2 ? 20 : 30", 20},
+		{"let x = false ? 1 : true ? 2 : 3; x", 2},
+		{"let f = fn() { 1 / 0 }; true ? 5 : f()", 5},
+		{"let n = 0; false ? n = 1 : n; n", 0},
+		{"let n = 0; let i = 0; while (i < 3) { i += 1; n += (if (true) { continue } else { true }) ? 1 : 2 }; n", 0},
+		{"(true ? fn(x) { x * 2 } : fn(x) { x })(4)", 8},
+		{"if (false) { 1 } else { 2 } ? 3 : 4", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{`
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+
+  return 1;
+}
+`, 10},
+		{`
+let f = fn(x) {
+  if (x > 1) {
+    if (x > 2) {
+      return x;
+    }
+  }
+  return 0;
+};
+f(5) + 1;
+`, 6},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input			string
+		expectedMessage	string
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"5; true + false; 5", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{`
+if (10 > 1) {
+  if (10 > 1) {
+    return true + false;
+  }
+
+  return 1;
+}
+`, "unknown operator: BOOLEAN + BOOLEAN"},
+		{"foobar", "identifier not found: foobar"},
+		{"5 / 0", "division by zero"},
+		{"5 % 0", "modulo by zero"},
+		{"1.5 / 0", "division by zero"},
+		{"1.5 + true", "type mismatch: FLOAT + BOOLEAN"},
+		{"true <= false", "unknown operator: BOOLEAN <= BOOLEAN"},
+		{"let f = fn(x) { x }; f(1, 2)", "wrong number of arguments: want=1, got=2"},
+		{"let f = fn(a, b = 2) { a }; f(1, 2, 3)", "wrong number of arguments: want=1..2, got=3"},
+		{"let f = fn(a, ...rest) { a }; f()", "wrong number of arguments: want=1+, got=0"},
+		{"let f = fn(a = b) { a }; f()", "identifier not found: b"},
+		{"5(1)", "not a function: INTEGER"},
+		{"(1 + true) ? 1 : 2", "type mismatch: INTEGER + BOOLEAN"},
+		{"1 |> 2", "not a function: INTEGER"},
+		{"let f = fn(x) { x }; 1 |> f(2)", "wrong number of arguments: want=1, got=2"},
+		{"if (false) { 1 } else if (-true) { 2 }", "unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	rests := []struct {
+		input		string
+		expected	string
+	}{
+		{"let f = fn(a, ...rest) { rest }; f(1)", "[]"},
+		{"let f = fn(a, ...rest) { rest }; f(1, 2, 3)", "[2, 3]"},
+	}
+
+	for _, tt := range rests {
+		arr, ok := testEval(tt.input).(*object.Array)
+		if !ok {
+			t.Fatalf("object is not Array for %q", tt.input)
+		}
+		if arr.Inspect() != tt.expected {
+			t.Errorf("rest wrong for %q. want %s, got=%s", tt.input, tt.expected, arr.Inspect())
+		}
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v",
+			fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	expectedBody := "(x + 2)"
+
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	rests := []struct {
+		input		string
+		expected	string
+	}{
+		{"let f = fn(a, ...rest) { rest }; f(1)", "[]"},
+		{"let f = fn(a, ...rest) { rest }; f(1, 2, 3)", "[2, 3]"},
+	}
+
+	for _, tt := range rests {
+		arr, ok := testEval(tt.input).(*object.Array)
+		if !ok {
+			t.Fatalf("object is not Array for %q", tt.input)
+		}
+		if arr.Inspect() != tt.expected {
+			t.Errorf("rest wrong for %q. want %s, got=%s", tt.input, tt.expected, arr.Inspect())
+		}
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+let newAdder = fn(x) {
+  fn(y) { x + y };
+};
+
+let addTwo = newAdder(2);
+addTwo(2);`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestRecursion(t *testing.T) {
+	input := `
+let fib = fn(n) {
+  if (n < 2) {
+    return n;
+  }
+  fib(n - 1) + fib(n - 2);
+};
+fib(15);`
+
+	testIntegerObject(t, testEval(input), 610)
+}
+
+func testEval(input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return Eval(program, env)
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello World!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	input := `"Hello" + " " + "World!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" + "b" == "ab"`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d",
+			len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	evaluated := testEval(`[1, 2]["a"]`)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Message != "index operator not supported: ARRAY[STRING]" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashKeyErrors(t *testing.T) {
+	tests := []struct {
+		input			string
+		expectedMessage	string
+	}{
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{`{fn(x) { x }: 1}`, "unusable as hash key: FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestLogicalShortCircuit(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	interface{}
+	}{
+		// The right side would blow up if it were ever evaluated
+		{"false && undefined", false},
+		{"true || undefined", true},
+		{"let f = fn() { 1 / 0 }; false && f()", false},
+		{"if (false) { 1 } || 2", 2},
+		{"true && 3", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	float64
+	}{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2},
+		{"7 / 2.0", 3.5},
+		{"5.5 % 2", 1.5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		result, ok := evaluated.(*object.Float)
+		if !ok {
+			t.Errorf("object is not Float. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if result.Value != tt.expected {
+			t.Errorf("object has wrong value. got=%g, want=%g", result.Value, tt.expected)
+		}
+	}
+}
+
+func TestFloatComparison(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	bool
+	}{
+		{"1.5 < 2", true},
+		{"2.0 == 2", true},
+		{"0.1 + 0.2 == 0.3", false},
+		{"2.5 >= 2.5", true},
+		{"-1.0 > 0", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	interface{}
+	}{
+		{"let i = 0; let sum = 0; while (i < 5) { let sum = sum + i; let i = i + 1; }; sum", 10},
+		{"let sum = 0; for (let i = 0; i < 5;) { let sum = sum + i; let i = i + 1; }; sum", 10},
+		{"let i = 0; while (true) { if (i == 3) { break; } let i = i + 1; }; i", 3},
+		{"let n = 0; for (let i = 0; i < 10;) { let i = i + 1; if (i % 2 == 0) { continue; } let n = n + 1; }; n", 5},
+		{"let i = 0; for (;;) { let i = i + 1; if (i > 4) { break } }; i", 5},
+		{"let f = fn() { let i = 0; while (true) { if (i == 7) { return i; } let i = i + 1; } }; f()", 7},
+		// break only leaves the innermost loop
+		{`
+let count = 0;
+for (let i = 0; i < 3;) {
+	for (let j = 0; j < 10;) {
+		if (j == 2) { break; }
+		let count = count + 1;
+		let j = j + 1;
+	}
+	let i = i + 1;
+}
+count`, 6},
+		{"while (false) { 1 }", nil},
+		{"let f = fn() { while (false) { 1 } }; f()", nil},
+		// A loop is null, whatever its body's last expression was
+		{"let i = 0; while (i < 2) { let i = i + 1; i * 10 }", nil},
+		{"for (;;) { 1; break }", nil},
+		// break, continue and return end the loop (or function) even from inside an expression
+		{"let x = 0; let i = 0; while (i < 5) { let y = if (i > 2) { break; } else { i }; let x = x + y; let i = i + 1 }; x", 3},
+		{"let x = 0; let i = 0; while (i < 5) { let i = i + 1; let y = -if (i % 2 == 0) { continue } else { i }; let x = x + y }; x", -9},
+		{"let f = fn() { let y = if (true) { return 5 } else { 1 }; y + 100 }; f()", 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		default:
+			if evaluated != NULL {
+				t.Errorf("loop is not null for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestLoopErrors(t *testing.T) {
+	evaluated := testEval("let i = 0; while (i < 3) { let i = i + true; }")
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	int64
+	}{
+		{"let x = 1; x = 5; x", 5},
+		{"let x = 1; x = x + 1", 2},
+		{"let x = 10; x += 5; x", 15},
+		{"let x = 10; x -= 5; x", 5},
+		{"let x = 10; x *= 5; x", 50},
+		{"let x = 10; x /= 5; x", 2},
+		{"let x = 1; let y = 2; x = y = 7; x + y", 14},
+		{"let arr = [1, 2, 3]; arr[1] = 20; arr[1]", 20},
+		{"let arr = [1, 2, 3]; arr[2] += 10; arr[2]", 13},
+		{`let h = {"a": 1}; h["a"] = 5; h["a"]`, 5},
+		{`let h = {}; h["new"] = 3; h["new"]`, 3},
+		// Assigning from inside a function updates the variable it closed over
+		{"let n = 0; let inc = fn() { n = n + 1 }; inc(); inc(); n", 2},
+		{"let counter = fn() { let c = 0; fn() { c += 1 } }(); counter(); counter()", 2},
+		// Arrays are shared, not copied
+		{"let a = [1]; let b = a; b[0] = 9; a[0]", 9},
+		{"let i = 0; let sum = 0; while (i < 4) { sum += i; i += 1; } sum", 6},
+		{"let calls = 0; let f = fn() { calls += 1; 0 }; let a = [1]; a[f()] += 1; calls", 1},
+		// Both sides of a comparison run left to right, so the last assignment wins
+		{"let x = 0; (x = 1) < (x = 2); x", 2},
+		// A compound assignment reads the current value before the right side runs, also left to right
+		{"let x = 1; x += (x = 10); x", 11},
+		{"let a = [1]; a[0] += (a[0] = 10); a[0]", 11},
+		{`let h = {"k": 2}; h["k"] *= (h["k"] = 5); h["k"]`, 10},
+		{"let f = fn() { let x = 1; let set = fn() { x = 10 }; x += set(); x }; f()", 11},
+		// A function's name inside its body is the variable it is bound to, so assigning to it rebinds that variable
+		{"let f = fn() { f = 5 }; f(); f", 5},
+		{"let f = fn() { f = 5; f }; f()", 5},
+		{"let f = fn() { let g = fn() { f = 1 }; g() }; f(); f", 1},
+		{"let outer = fn() { let f = fn() { f = 5 }; f(); f }; outer()", 5},
+		{"fn f() { f = 3 } f(); f", 3},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	rests := []struct {
+		input		string
+		expected	string
+	}{
+		{"let f = fn(a, ...rest) { rest }; f(1)", "[]"},
+		{"let f = fn(a, ...rest) { rest }; f(1, 2, 3)", "[2, 3]"},
+	}
+
+	for _, tt := range rests {
+		arr, ok := testEval(tt.input).(*object.Array)
+		if !ok {
+			t.Fatalf("object is not Array for %q", tt.input)
+		}
+		if arr.Inspect() != tt.expected {
+			t.Errorf("rest wrong for %q. want %s, got=%s", tt.input, tt.expected, arr.Inspect())
+		}
+	}
+}
+
+func TestAssignErrors(t *testing.T) {
+	tests := []struct {
+		input			string
+		expectedMessage	string
+	}{
+		{"y = 1", "identifier not found: y"},
+		{"y += 1", "identifier not found: y"},
+		{"let x = true; x += 1", "type mismatch: BOOLEAN + INTEGER"},
+		{"let a = [1]; a[5] = 1", "index out of range: 5, array has 1 elements"},
+		{"let x = 1; x[0] = 1", "index assignment not supported: INTEGER[INTEGER]"},
+		{`let h = {}; h[fn(x) { x }] = 1`, "unusable as hash key: FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestFunctionDeclarations(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	int64
+	}{
+		{"fn add(a, b) { a + b } add(2, 3)", 5},
+		// Hoisted, so it can be called before it is declared
+		{"let x = double(4); fn double(n) { n * 2 } x", 8},
+		// Mutually recursive, in either order
+		{`
+fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }
+fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }
+if (isEven(10)) { 1 } else { 0 }`, 1},
+		{`
+let f = fn() {
+	fn a(n) { if (n == 0) { 0 } else { b(n - 1) + 1 } }
+	fn b(n) { if (n == 0) { 0 } else { a(n - 1) + 1 } }
+	a(7)
+};
+f()`, 7},
+		// The x on the right of a let is the outer one, whether or not the block declares functions
+		{"let x = 1; let f = fn() { fn g() { x }; let x = x + 1; x }; f()", 2},
+		{"let x = 1; let f = fn() { fn g() { x }; let x = x + 1; g() }; f()", 2},
+		{"let x = 1; fn g() { x } let x = x + 1; g()", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	rests := []struct {
+		input		string
+		expected	string
+	}{
+		{"let f = fn(a, ...rest) { rest }; f(1)", "[]"},
+		{"let f = fn(a, ...rest) { rest }; f(1, 2, 3)", "[2, 3]"},
+	}
+
+	for _, tt := range rests {
+		arr, ok := testEval(tt.input).(*object.Array)
+		if !ok {
+			t.Fatalf("object is not Array for %q", tt.input)
+		}
+		if arr.Inspect() != tt.expected {
+			t.Errorf("rest wrong for %q. want %s, got=%s", tt.input, tt.expected, arr.Inspect())
+		}
+	}
+
+	// A declaration's value is null - a block ending in one doesn't take the value of the statement before it
+	for _, input := range []string{"let f = fn() { 1; fn inner() { 2 } }; f()", "if (true) { 1; fn inner() { 2 } }", "1; fn f() { 2 }"} {
+		testNullObject(t, testEval(input))
+	}
+}
+
+func TestFunctionName(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	string
+	}{
+		{"fn add(a, b) { a + b } add", "add"},
+		{"let sub = fn(a, b) { a - b }; sub", "sub"},
+		{"fn(a) { a }", ""},
+	}
+
+	for _, tt := range tests {
+		fn, ok := testEval(tt.input).(*object.Function)
+		if !ok {
+			t.Fatalf("object is not Function for %q", tt.input)
+		}
+		if fn.Name != tt.expected {
+			t.Errorf("fn.Name wrong for %q. want %q, got=%q", tt.input, tt.expected, fn.Name)
+		}
+	}
+}
+
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	int64
+	}{
+		{"let f = fn(a, b = 10) { a + b }; f(1)", 11},
+		{"let f = fn(a, b = 10) { a + b }; f(1, 2)", 3},
+		// Defaults are evaluated on each call and can see earlier parameters
+		{"let f = fn(a, b = a * 2) { a + b }; f(3)", 9},
+		{"let n = 0; let f = fn(a = n += 1) { a }; f(); f(); f()", 3},
+		{"let f = fn(a, ...rest) { rest[1] }; f(1, 2, 3)", 3},
+		{"let f = fn(...rest) { rest[1] }; f(4, 5, 6)", 5},
+		{"let f = fn(a, b = 2, ...rest) { b }; f(1)", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	rests := []struct {
+		input		string
+		expected	string
+	}{
+		{"let f = fn(a, ...rest) { rest }; f(1)", "[]"},
+		{"let f = fn(a, ...rest) { rest }; f(1, 2, 3)", "[2, 3]"},
+	}
+
+	for _, tt := range rests {
+		arr, ok := testEval(tt.input).(*object.Array)
+		if !ok {
+			t.Fatalf("object is not Array for %q", tt.input)
+		}
+		if arr.Inspect() != tt.expected {
+			t.Errorf("rest wrong for %q. want %s, got=%s", tt.input, tt.expected, arr.Inspect())
+		}
+	}
+}
+
+func TestPipeExpressions(t *testing.T) {
+	tests := []struct {
+		input		string
+		expected	int64
+	}{
+		{"let double = fn(x) { x * 2 }; 5 |> double", 10},
+		{"let double = fn(x) { x * 2 }; 5 |> double()", 10},
+		{"let sub = fn(a, b) { a - b }; 10 |> sub(3)", 7},
+		{"let sub = fn(a, b) { a - b }; let double = fn(x) { x * 2 }; 10 |> sub(4) |> double", 12},
+		{"let add = fn(a, b) { a + b }; 1 + 2 |> add(10)", 13},
+		{"4 |> fn(x) { x * x }", 16},
+		{"let adder = fn(n) { fn(x, y) { x + y + n } }; 1 |> adder(100)(10)", 111},
+		{"let f = fn(a, ...rest) { rest[0] }; 1 |> f(2, 3)", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
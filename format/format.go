@@ -0,0 +1,465 @@
+package format
+
+// Prints an AST back out as Monkey source - the one canonical way, so the output doesn't depend on how the input was laid out
+// Unlike String() on the nodes, the result can be parsed again and gives back the same tree
+
+import (
+	"bytes"
+	"errors"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"strconv"
+	"strings"
+	"monkey/token"
+)
+
+// Parse src and print it in canonical form, comments included
+// Source that doesn't parse is handed back as an error rather than half formatted
+func Source(filename string, src string) (string, error) {
+	p := parser.New(lexer.NewWithFilename(filename, src))
+	program := p.ParseProgram()
+
+	if errs := p.Errors(); len(errs) > 0 {
+		return "", errors.New(strings.Join(errs, "\n"))
+	}
+
+	return Program(program), nil
+}
+
+// Print a whole program, putting back the comments the parser collected
+func Program(program *ast.Program) string {
+	pr := &printer{comments: program.Comments}
+	pr.statements(program.Statements)
+	pr.flushComments(-1) // Whatever is left comes after the last statement
+
+	if pr.out.Len() > 0 {
+		pr.out.WriteByte('\n')
+	}
+	return pr.out.String()
+}
+
+// Print any node on its own, without comments - a block or a function body comes out indented as if it were at the top level
+func Node(node ast.Node) string {
+	pr := &printer{}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		return Program(&ast.Program{Statements: node.Statements})
+	case ast.Statement:
+		pr.statement(node, false)
+	case ast.Expression:
+		pr.expression(node, lowest)
+	case *ast.Parameter:
+		pr.parameter(node)
+	case *ast.ElseIf:
+		pr.elseIf(node)
+	}
+
+	return pr.out.String()
+}
+
+// The parser's binding powers, weakest first - an operand that binds weaker than the operator it sits under needs parentheses
+const (
+	_ int = iota
+	lowest
+	assignment	// = or += and friends
+	ternary		// cond ? a : b
+	logicalOr	// ||
+	logicalAnd	// &&
+	pipeline	// |>
+	equals		// == or !=
+	lessGreater	// > or < or >= or <=
+	sum			// + or -
+	product		// * or / or %
+	prefix		// -X or !X
+	call		// myFunction(X) and array[index] - both just tack something on to the end
+	primary		// Literals, names and anything else that has brackets of its own
+)
+
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.AssignExpression:
+		return assignment
+	case *ast.ConditionalExpression:
+		return ternary
+	case *ast.LogicalExpression:
+		if e.Operator == "||" {
+			return logicalOr
+		}
+		return logicalAnd
+	case *ast.PipeExpression:
+		return pipeline
+	case *ast.InfixExpression:
+		switch e.Operator {
+		case "==", "!=":
+			return equals
+		case "<", ">", "<=", ">=":
+			return lessGreater
+		case "+", "-":
+			return sum
+		}
+		return product
+	case *ast.PrefixExpression:
+		return prefix
+	case *ast.CallExpression, *ast.IndexExpression:
+		return call
+	}
+	return primary
+}
+
+type printer struct {
+	out bytes.Buffer
+	indent int // How many tabs go in front of each line
+
+	comments []token.Comment // All of the program's comments, in source order
+	next int // The first comment we haven't printed yet
+	lastLine int // The source line the last thing we printed ended on - tells us where blank lines were and which comments trail a line
+	blockStart bool // Nothing printed yet since the last '{', so no blank line goes here
+}
+
+// Start a new output line for something that came from the given source line
+// A blank line in the source (or several) between two statements comes out as exactly one
+func (p *printer) newline(line int, allowBlank bool) {
+	if p.out.Len() > 0 {
+		p.out.WriteByte('\n')
+		if allowBlank && !p.blockStart && p.lastLine > 0 && line > p.lastLine+1 {
+			p.out.WriteByte('\n')
+		}
+	}
+	p.blockStart = false
+	p.out.WriteString(strings.Repeat("\t", p.indent))
+}
+
+// Print every comment that starts before offset (all of them for -1)
+// Comments only ever go between statements - one that started on the line we just finished trails it, anything else gets a line of its own
+func (p *printer) flushComments(offset int) {
+	for p.next < len(p.comments) && (offset < 0 || p.comments[p.next].Start.Offset < offset) {
+		c := p.comments[p.next]
+		if p.out.Len() > 0 && p.lastLine > 0 && c.Start.Line == p.lastLine {
+			p.out.WriteByte(' ')
+		} else {
+			p.newline(c.Start.Line, true)
+		}
+		p.out.WriteString(c.Text)
+		if c.End.Line > p.lastLine { // A comment from inside the statement we just printed is behind us already
+			p.lastLine = c.End.Line
+		}
+		p.next += 1
+	}
+}
+
+// Is there a comment left that starts before offset?
+func (p *printer) commentBefore(offset int) bool {
+	return p.next < len(p.comments) && p.comments[p.next].Start.Offset < offset
+}
+
+func (p *printer) statements(statements []ast.Statement) {
+	for i, s := range statements {
+		p.flushComments(s.Pos().Offset)
+		p.newline(s.Pos().Line, true)
+
+		// The last expression in a block is its value, so it goes without a semicolon, like the book writes it
+		last := i == len(statements)-1 && p.indent > 0
+		semicolon := !last
+		if !last && isIfStatement(s) {
+			// An if ends in a brace, so it doesn't need one either - unless the next line could be read as carrying on from it
+			semicolon = i+1 < len(statements) && continuesExpression(statements[i+1])
+		}
+
+		p.statement(s, semicolon)
+		p.lastLine = s.End().Line
+	}
+}
+
+func isIfStatement(s ast.Statement) bool {
+	es, ok := s.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	_, ok = es.Expression.(*ast.IfExpression)
+	return ok
+}
+
+// Would this statement, written right after an expression, be parsed as more of that expression? if (x) { a } -1 would be a subtraction
+func continuesExpression(s ast.Statement) bool {
+	if _, ok := s.(*ast.ExpressionStatement); !ok {
+		return false
+	}
+	text := Node(s)
+	return strings.HasPrefix(text, "(") || strings.HasPrefix(text, "[") || strings.HasPrefix(text, "-")
+}
+
+// Print a statement - semicolon says whether an expression statement gets one, the other statements always know what they need
+func (p *printer) statement(s ast.Statement, semicolon bool) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.simpleStatement(s)
+		p.out.WriteString(";")
+
+	case *ast.ReturnStatement:
+		p.out.WriteString("return")
+		if s.ReturnValue != nil {
+			p.out.WriteString(" ")
+			p.expression(s.ReturnValue, lowest)
+		}
+		p.out.WriteString(";")
+
+	case *ast.ExpressionStatement:
+		p.simpleStatement(s)
+		if semicolon {
+			p.out.WriteString(";")
+		}
+
+	case *ast.FunctionStatement:
+		p.out.WriteString("fn ")
+		p.out.WriteString(s.Name.Value)
+		p.function(s.Function)
+
+	case *ast.WhileStatement:
+		p.out.WriteString("while (")
+		p.expression(s.Condition, lowest)
+		p.out.WriteString(") ")
+		p.block(s.Body)
+
+	case *ast.ForStatement:
+		p.out.WriteString("for (")
+		if s.Init != nil {
+			p.simpleStatement(s.Init)
+		}
+		p.out.WriteString(";")
+		if s.Condition != nil {
+			p.out.WriteString(" ")
+			p.expression(s.Condition, lowest)
+		}
+		p.out.WriteString(";")
+		if s.Post != nil {
+			p.out.WriteString(" ")
+			p.simpleStatement(s.Post)
+		}
+		p.out.WriteString(") ")
+		p.block(s.Body)
+
+	case *ast.BreakStatement:
+		p.out.WriteString("break;")
+
+	case *ast.ContinueStatement:
+		p.out.WriteString("continue;")
+
+	case *ast.BlockStatement:
+		p.block(s)
+
+	case *ast.BadStatement:
+		p.out.WriteString(s.String())
+	}
+}
+
+// A let or an expression statement without its semicolon - the clauses of a for loop are written this way
+func (p *printer) simpleStatement(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.out.WriteString("let ")
+		p.out.WriteString(s.Name.Value)
+		p.out.WriteString(" = ")
+		if s.Value != nil {
+			p.expression(s.Value, lowest)
+		}
+	case *ast.ExpressionStatement:
+		if s.Expression != nil {
+			p.expression(s.Expression, lowest)
+		}
+	}
+}
+
+// Blocks always get a line per statement, and the closing brace lines up with the line the block started on
+func (p *printer) block(b *ast.BlockStatement) {
+	p.out.WriteString("{")
+	p.lastLine = b.Pos().Line
+
+	closing := b.End()
+	if b.Rbrace.Start.IsValid() {
+		closing = b.Rbrace.Start
+	}
+
+	if len(b.Statements) == 0 && !p.commentBefore(closing.Offset) {
+		p.out.WriteString("}")
+		p.lastLine = b.End().Line
+		return
+	}
+
+	p.indent += 1
+	p.blockStart = true
+	p.statements(b.Statements)
+	p.flushComments(closing.Offset)
+	p.indent -= 1
+
+	p.newline(closing.Line, false)
+	p.out.WriteString("}")
+	p.lastLine = b.End().Line
+}
+
+// The parameter list and body of a function - the fn keyword and the name are up to the caller
+func (p *printer) function(fl *ast.FunctionLiteral) {
+	p.out.WriteString("(")
+	for i, param := range fl.Parameters {
+		if i > 0 {
+			p.out.WriteString(", ")
+		}
+		p.parameter(param)
+	}
+	p.out.WriteString(") ")
+	p.block(fl.Body)
+}
+
+func (p *printer) parameter(param *ast.Parameter) {
+	if param.Rest {
+		p.out.WriteString("...")
+	}
+	p.out.WriteString(param.Name.Value)
+	if param.Default != nil {
+		p.out.WriteString(" = ")
+		p.expression(param.Default, lowest)
+	}
+}
+
+func (p *printer) elseIf(ei *ast.ElseIf) {
+	p.out.WriteString("else if (")
+	p.expression(ei.Condition, lowest)
+	p.out.WriteString(") ")
+	p.block(ei.Consequence)
+}
+
+// Print an expression that sits somewhere only expressions binding at least as tightly as min can go without parentheses
+func (p *printer) expression(e ast.Expression, min int) {
+	if precedence(e) < min {
+		p.out.WriteString("(")
+		p.expression(e, lowest)
+		p.out.WriteString(")")
+		return
+	}
+
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.out.WriteString(e.Value)
+
+	case *ast.IntegerLiteral:
+		if e.Token.Literal != "" {
+			p.out.WriteString(e.Token.Literal) // Keep 0xFF and 1_000 the way they were written
+		} else {
+			p.out.WriteString(strconv.FormatInt(e.Value, 10))
+		}
+
+	case *ast.FloatLiteral:
+		if e.Token.Literal != "" {
+			p.out.WriteString(e.Token.Literal)
+		} else {
+			p.out.WriteString(formatFloat(e.Value))
+		}
+
+	case *ast.StringLiteral:
+		p.out.WriteString(ast.QuoteString(e.Value))
+
+	case *ast.Boolean:
+		p.out.WriteString(strconv.FormatBool(e.Value))
+
+	case *ast.PrefixExpression:
+		p.out.WriteString(e.Operator)
+		p.expression(e.Right, prefix)
+
+	case *ast.InfixExpression:
+		// Left-associative: a - b - c is (a - b) - c, so an operand of the same strength needs parentheses on the right only
+		level := precedence(e)
+		p.expression(e.Left, level)
+		p.out.WriteString(" " + e.Operator + " ")
+		p.expression(e.Right, level+1)
+
+	case *ast.LogicalExpression:
+		level := precedence(e)
+		p.expression(e.Left, level)
+		p.out.WriteString(" " + e.Operator + " ")
+		p.expression(e.Right, level+1)
+
+	case *ast.PipeExpression:
+		p.expression(e.Left, pipeline)
+		p.out.WriteString(" |> ")
+		p.expression(e.Right, pipeline+1)
+
+	case *ast.ConditionalExpression:
+		// Right-associative: a ? b : c ? d : e needs no parentheses, but a nested conditional in front of the ? does
+		p.expression(e.Condition, ternary+1)
+		p.out.WriteString(" ? ")
+		p.expression(e.Consequence, lowest)
+		p.out.WriteString(" : ")
+		p.expression(e.Alternative, ternary)
+
+	case *ast.AssignExpression:
+		p.expression(e.Target, assignment+1)
+		p.out.WriteString(" " + e.Operator + " ")
+		p.expression(e.Value, assignment)
+
+	case *ast.CallExpression:
+		p.expression(e.Function, call)
+		p.out.WriteString("(")
+		p.expressionList(e.Arguments)
+		p.out.WriteString(")")
+
+	case *ast.IndexExpression:
+		p.expression(e.Left, call)
+		p.out.WriteString("[")
+		p.expression(e.Index, lowest)
+		p.out.WriteString("]")
+
+	case *ast.ArrayLiteral:
+		p.out.WriteString("[")
+		p.expressionList(e.Elements)
+		p.out.WriteString("]")
+
+	case *ast.HashLiteral:
+		p.out.WriteString("{")
+		for i, pair := range e.Pairs {
+			if i > 0 {
+				p.out.WriteString(", ")
+			}
+			p.expression(pair.Key, lowest)
+			p.out.WriteString(": ")
+			p.expression(pair.Value, lowest)
+		}
+		p.out.WriteString("}")
+
+	case *ast.FunctionLiteral:
+		p.out.WriteString("fn")
+		p.function(e)
+
+	case *ast.IfExpression:
+		p.out.WriteString("if (")
+		p.expression(e.Condition, lowest)
+		p.out.WriteString(") ")
+		p.block(e.Consequence)
+		for _, ei := range e.ElseIfs {
+			p.out.WriteString(" ")
+			p.elseIf(ei)
+		}
+		if e.Alternative != nil {
+			p.out.WriteString(" else ")
+			p.block(e.Alternative)
+		}
+	}
+}
+
+func (p *printer) expressionList(expressions []ast.Expression) {
+	for i, e := range expressions {
+		if i > 0 {
+			p.out.WriteString(", ")
+		}
+		p.expression(e, lowest)
+	}
+}
+
+// A float made up by hand still has to read back as a float - 2 would come back as an integer
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEnN") { // NaN and Inf can't be written down anyway
+		s += ".0"
+	}
+	return s
+}
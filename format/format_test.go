@@ -0,0 +1,255 @@
+package format
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=1+2*3", "let x = 1 + 2 * 3;\n"},
+		{"return 1", "return 1;\n"},
+		{"let f = fn(x) { x }", "let f = fn(x) {\n\tx\n};\n"},
+		{"fn add(a,b){return a+b;}", "fn add(a, b) {\n\treturn a + b;\n}\n"},
+		{"fn() {}", "fn() {};\n"},
+		{"fn(a, b = 2, ...rest) { a }", "fn(a, b = 2, ...rest) {\n\ta\n};\n"},
+		{"if (x) { 1 } else if (y) { 2 } else { 3 }", "if (x) {\n\t1\n} else if (y) {\n\t2\n} else {\n\t3\n}\n"},
+		{"while (true) { x += 1; break }", "while (true) {\n\tx += 1;\n\tbreak;\n}\n"},
+		{"for(;;){continue}", "for (;;) {\n\tcontinue;\n}\n"},
+		{"for (let i = 0; i < 3; i = i + 1) {}", "for (let i = 0; i < 3; i = i + 1) {}\n"},
+		{"for (; i < 3;) { }", "for (; i < 3;) {}\n"},
+		{`{"a": [1, 2], 3: fn(){}}`, "{\"a\": [1, 2], 3: fn() {}};\n"},
+		{`"quote \" and \\ and \t"`, "\"quote \\\" and \\\\ and \\t\";\n"},
+		{"0xFF + 1_000 + 1.5e3", "0xFF + 1_000 + 1.5e3;\n"},
+		{"f(a)(b)[0]", "f(a)(b)[0];\n"},
+		{"xs |> map(f) |> g", "xs |> map(f) |> g;\n"},
+		{"x = y = 3", "x = y = 3;\n"},
+		{"a[i] += 1", "a[i] += 1;\n"},
+
+		// Only the parentheses the parser needs survive
+		{"(1 + 2) * 3", "(1 + 2) * 3;\n"},
+		{"1 + (2 * 3)", "1 + 2 * 3;\n"},
+		{"(a - b) - c", "a - b - c;\n"},
+		{"a - (b - c)", "a - (b - c);\n"},
+		{"-(a + b)", "-(a + b);\n"},
+		{"-(-a)", "--a;\n"},
+		{"!(a == b)", "!(a == b);\n"},
+		{"(a || b) && c", "(a || b) && c;\n"},
+		{"a || (b && c)", "a || b && c;\n"},
+		{"a ? b : (c ? d : e)", "a ? b : c ? d : e;\n"},
+		{"(a ? b : c) ? d : e", "(a ? b : c) ? d : e;\n"},
+		{"a ? (x = 1) : y", "a ? x = 1 : y;\n"},
+		{"a ? b : (y = 2)", "a ? b : (y = 2);\n"},
+		{"(xs |> f) |> g", "xs |> f |> g;\n"},
+		{"xs |> (f |> g)", "xs |> (f |> g);\n"},
+		{"(a < b) == (c > d)", "a < b == c > d;\n"},
+		{"(-f)(x)", "(-f)(x);\n"},
+		{"(a + b)[0]", "(a + b)[0];\n"},
+		{"(fn(x) { x })(1)", "fn(x) {\n\tx\n}(1);\n"},
+
+		// An if statement only needs a semicolon when the next statement would otherwise carry on its expression
+		{"if (a) { 1 }; -1", "if (a) {\n\t1\n};\n-1;\n"},
+		{"if (a) { 1 }; (a + b) * c", "if (a) {\n\t1\n};\n(a + b) * c;\n"},
+		{"if (a) { 1 }; (b)(c)", "if (a) {\n\t1\n}\nb(c);\n"},
+		{"if (a) { 1 }; [1]", "if (a) {\n\t1\n};\n[1];\n"},
+		{"if (a) { 1 }; b", "if (a) {\n\t1\n}\nb;\n"},
+		{"if (a) { 1 }; let b = 2;", "if (a) {\n\t1\n}\nlet b = 2;\n"},
+
+		// The last expression of a block is its value, and goes without a semicolon
+		{"fn f() { let a = 1; a; }", "fn f() {\n\tlet a = 1;\n\ta\n}\n"},
+
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source("", tt.input)
+		if err != nil {
+			t.Fatalf("Source(%q) failed: %s", tt.input, err)
+		}
+		if formatted != tt.expected {
+			t.Errorf("wrong formatting for %q.\nwant %q\ngot= %q", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// Leading comment
+
+
+let x = 1; // trailing
+let f = fn(a) { // after the brace
+	/* before y */ let y = a;
+
+
+	y // the value
+};
+/* block
+   comment */
+if (x) {
+	// only a comment
+} else { 2 }
+let g = h(1, // inside a call
+	2);
+// the end
+`
+	expected := `// Leading comment
+
+let x = 1; // trailing
+let f = fn(a) { // after the brace
+	/* before y */
+	let y = a;
+
+	y // the value
+};
+/* block
+   comment */
+if (x) {
+	// only a comment
+} else {
+	2
+}
+let g = h(1, 2);
+// inside a call
+// the end
+`
+
+	formatted, err := Source("", input)
+	if err != nil {
+		t.Fatalf("Source failed: %s", err)
+	}
+	if formatted != expected {
+		t.Errorf("wrong formatting.\nwant:\n%s\ngot:\n%s", expected, formatted)
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source("bad.mk", "let = 1;")
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if err.Error() != "bad.mk:1:5: expected next token to be IDENT, got = instead" {
+		t.Errorf("wrong error. got=%q", err.Error())
+	}
+}
+
+// Nodes made up by hand have no tokens to fall back on
+func TestNode(t *testing.T) {
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{&ast.IntegerLiteral{Value: 42}, "42"},
+		{&ast.FloatLiteral{Value: 2}, "2.0"},
+		{&ast.FloatLiteral{Value: 0.25}, "0.25"},
+		{&ast.FloatLiteral{Value: 1e100}, "1e+100"},
+		{&ast.StringLiteral{Value: "a\nb"}, `"a\nb"`},
+		{
+			&ast.InfixExpression{
+				Left:     &ast.InfixExpression{Left: &ast.Identifier{Value: "a"}, Operator: "+", Right: &ast.Identifier{Value: "b"}},
+				Operator: "*",
+				Right:    &ast.Identifier{Value: "c"},
+			},
+			"(a + b) * c",
+		},
+		{&ast.Parameter{Name: &ast.Identifier{Value: "rest"}, Rest: true}, "...rest"},
+		{&ast.LetStatement{Name: &ast.Identifier{Value: "x"}, Value: &ast.Boolean{Value: true}}, "let x = true;"},
+	}
+
+	for _, tt := range tests {
+		if Node(tt.node) != tt.expected {
+			t.Errorf("Node(%T) wrong. want %q, got=%q", tt.node, tt.expected, Node(tt.node))
+		}
+	}
+}
+
+// A grab bag of everything the parser understands, laid out badly on purpose
+const corpus = `
+// A comment up front
+let   x=1+2*3-4/5%6;let y = -x;   let z = !true == false;
+let s = "tab\there \u{1F600} \"quoted\"";
+let n = 0x_FF + 0o17 + 0b1010 + 1_000 + 1.5e-3 + .5;
+fn fib(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }
+let add = fn(a, b = 2, ...rest) { a + b };
+let h = {"one": 1, 2: [1, 2, 3], true: fn(x) { x * x }};
+let r = h["one"] + h[2][0];
+if (x > 1) { "big" } else if (x < 0) { "negative" } else { "small" }
+let max = a > b ? a : b; let nested = a ? b : c ? d : e;
+let piped = [1, 2] |> map(fn(v) { v * 2 }) |> sum;
+while (x < 10) { x += 1; if (x == 5) { continue } if (x == 8) { break } }
+for (let i = 0; i < 3; i += 1) { y *= 2; }
+for (;;) { break; }
+a = b = c; h["k"] -= 1;
+a && b || !c && (d || e);
+(fn() { 1 })();
+/* trailing block comment */
+`
+
+func TestRoundTrip(t *testing.T) {
+	original := parse(t, corpus)
+
+	formatted, err := Source("", corpus)
+	if err != nil {
+		t.Fatalf("Source failed: %s", err)
+	}
+
+	reparsed := parse(t, formatted)
+
+	if describe(original) != describe(reparsed) {
+		t.Errorf("formatting changed the program.\nbefore: %s\nafter:  %s", describe(original), describe(reparsed))
+	}
+
+	if len(original.Comments) != len(reparsed.Comments) {
+		t.Fatalf("lost comments. had %d, got=%d", len(original.Comments), len(reparsed.Comments))
+	}
+	for i, c := range original.Comments {
+		if reparsed.Comments[i].Text != c.Text {
+			t.Errorf("comment %d changed. want %q, got=%q", i, c.Text, reparsed.Comments[i].Text)
+		}
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	inputs := []string{corpus, "if (a) { 1 }; -1", "let f = fn(a) { // c\n\t/* x */ a };\n// end"}
+
+	for _, input := range inputs {
+		once, err := Source("", input)
+		if err != nil {
+			t.Fatalf("Source failed: %s", err)
+		}
+		twice, err := Source("", once)
+		if err != nil {
+			t.Fatalf("formatted output doesn't parse: %s\n%s", err, once)
+		}
+		if once != twice {
+			t.Errorf("formatting is not idempotent.\nonce:\n%s\ntwice:\n%s", once, twice)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v\n%s", p.Errors(), input)
+	}
+	return program
+}
+
+// Every node of the tree with its type and how it prints, so two trees that only differ in positions come out the same
+func describe(program *ast.Program) string {
+	var out []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node != nil {
+			out = append(out, fmt.Sprintf("%T %s", node, node.String()))
+		}
+		return true
+	})
+	return strings.Join(out, "\n")
+}
@@ -1,36 +1,184 @@
 package lexer
 
-import "monkey/token"
+import (
+	"fmt"
+	"io"
+	"monkey/diag"
+	"monkey/token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 type Lexer struct {
-	input        string
+	buf          []byte    // The part of the input we still need - buf[0] is the byte at offset base
+	base         int       // Offset of buf[0] in the whole input
+	mark         int       // Offset of the start of the token or comment we are reading - nothing before it is needed anymore
+	src          io.Reader // Where the rest of the input comes from - nil once we've read all of it
+	err          error     // The read error that cut the input short, if any
+	errReported  bool      // Whether err made it into the diagnostics yet - we wait until we get to where the input stops
+	filename     string // Name of the source, if any - stamped onto every position we hand out
 	position     int  // Current position in input (points to current char)
 	readPosition int  // Current reading position in input (after current char) - we'll need to be able to peek further into the input after the current character
-	ch           byte // Current char under examination (ascii values are sufficiently encompassed by 8 bits) - would have to be a 'rune' if we were supporting all of Unicode
+	ch           rune // Current char under examination - a whole Unicode code point, decoded from however many UTF-8 bytes it took
+	line         int  // Line of the current char, starting at 1
+	column       int  // Column of the current char, starting at 1
+
+	diagnostics  []diag.Diagnostic // Problems we ran into while lexing - the offending tokens come out as ILLEGAL
 }
 
+// How much we ask the reader for at a time - the buffer only grows past this for a token that doesn't fit
+const readSize = 4096
+
 func New(input string) *Lexer { // Returns a pointer to a Lexer struct
-	l := &Lexer{input: input} // The address of the lexer
+	return NewWithFilename("", input)
+}
+
+// Same as New, but every token position will also carry the given file name
+func NewWithFilename(filename string, input string) *Lexer {
+	l := &Lexer{buf: []byte(input), filename: filename, line: 1} // The address of the lexer - no reader, the whole input is already here
 	l.readChar() // So that the first character is read - when we call NextToken() it will not be "EOF" with value 0
 	return l
 }
 
-// If we were supporting more characters, like all of Unicode (including emoji's), then we would need to change how this is done - read position may go up by more than a byte
+// Lex whatever the reader produces, reading it a chunk at a time as the tokens are asked for
+// We only hold on to the token being read, so a long script or an endless stream doesn't pile up in memory
+func NewReader(r io.Reader) *Lexer {
+	return NewReaderWithFilename("", r)
+}
+
+// Same as NewReader, but every token position will also carry the given file name
+func NewReaderWithFilename(filename string, r io.Reader) *Lexer {
+	l := &Lexer{buf: make([]byte, 0, readSize), src: r, filename: filename, line: 1}
+	l.readChar()
+	return l
+}
+
+// The error that stopped us reading the input, or nil if we got all of it (io.EOF doesn't count)
+// It is also in Diagnostics() as a read-error, but callers that only care about I/O can check here
+func (l *Lexer) Err() error {
+	return l.err
+}
+
+// Make sure every byte before offset end is in the buffer, reading more if we have to
+// Returns false if the input runs out (or fails) first
+func (l *Lexer) ensure(end int) bool {
+	for l.base+len(l.buf) < end && l.src != nil {
+		l.fill()
+	}
+	return l.base+len(l.buf) >= end
+}
+
+// Read another chunk from the source, first dropping whatever comes before the mark
+func (l *Lexer) fill() {
+	if l.mark > l.base {
+		n := copy(l.buf, l.buf[l.mark-l.base:])
+		l.buf = l.buf[:n]
+		l.base = l.mark
+	}
+	if len(l.buf) == cap(l.buf) { // Only happens when a single token is bigger than what we've got room for
+		grown := make([]byte, len(l.buf), 2*cap(l.buf))
+		copy(grown, l.buf)
+		l.buf = grown
+	}
+
+	// Readers are allowed to hand back nothing without an error now and then - but not forever, same as bufio
+	var n int
+	var err error
+	for tries := 0; n == 0 && err == nil; tries++ {
+		if tries == 100 {
+			err = io.ErrNoProgress
+			break
+		}
+		n, err = l.src.Read(l.buf[len(l.buf):cap(l.buf)])
+	}
+	l.buf = l.buf[:len(l.buf)+n]
+
+	if err == io.EOF {
+		l.src = nil
+	} else if err != nil {
+		l.src = nil // Treat it as the end of the input, so whatever we have so far still gets lexed
+		l.err = err
+	}
+}
+
+// The source between two offsets - both must be at or after the mark
+func (l *Lexer) slice(start int, end int) string {
+	return string(l.buf[start-l.base : end-l.base])
+}
+
+// Move on to the next char - the input is UTF-8, so the read position may go up by more than a byte, but the column only ever goes up by one
 func (l *Lexer) readChar() { // Takes in a pointer to a lexer
-	if l.readPosition >= len(l.input) {
+	if l.ch == '\n' { // Moving past a newline puts us at the start of the next line
+		l.line += 1
+		l.column = 1
+	} else if l.ensure(l.readPosition) { // Stop counting columns once we are sitting on the end of the input
+		l.column += 1
+	}
+	width := 1
+	if !l.ensure(l.readPosition + 1) {
 		l.ch = 0 // ASCII for "NUL" - either at the end of the file or we haven't read anything yet
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ensure(l.readPosition + utf8.UTFMax) // A code point may straddle two chunks
+		l.ch, width = utf8.DecodeRune(l.buf[l.readPosition-l.base:]) // Hands back utf8.RuneError with a width of 1 for bytes that aren't valid UTF-8
 	}
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += width
+}
+
+// The current char exactly as it was spelled in the input - for invalid UTF-8 that's the offending byte rather than utf8.RuneError
+func (l *Lexer) rawChar() string {
+	if !l.ensure(l.position + 1) {
+		return ""
+	}
+	return l.slice(l.position, l.readPosition)
+}
+
+// Everything that went wrong while lexing so far, in the order we found it
+func (l *Lexer) Diagnostics() []diag.Diagnostic {
+	return l.diagnostics
+}
+
+// Record an error covering the source between start and end
+func (l *Lexer) report(code diag.Code, start token.Position, end token.Position, format string, a ...interface{}) *diag.Diagnostic {
+	l.diagnostics = append(l.diagnostics, diag.Diagnostic{
+		Severity: diag.Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Span:     diag.Span{Start: start, End: end},
+	})
+	return &l.diagnostics[len(l.diagnostics)-1] // So the caller can attach more detail
+}
+
+// Where the current char sits in the source
+func (l *Lexer) pos() token.Position {
+	offset := l.position
+	if !l.ensure(offset) {
+		offset = l.base + len(l.buf) // We keep "reading" NUL past the end, but there is nothing out there
+	}
+	return token.Position{Filename: l.filename, Line: l.line, Column: l.column, Offset: offset}
+}
+
+// Where the char just past the current one sits - handy for spans that should include the current char
+func (l *Lexer) peekPos() token.Position {
+	pos := l.pos()
+	if l.ensure(l.position + 1) {
+		pos.Column += 1
+		pos.Offset = l.readPosition
+	}
+	return pos
 }
 
 func (l *Lexer) NextToken() token.Token {
 
 	var tok token.Token
 
-	l.skipWhitespace()
+	comments := l.skipTrivia()
+
+	start := l.pos() // Remember where this token begins
+	tok.Start = start
+	tok.Leading = comments
 
 	switch l.ch {
 	case '=':
@@ -43,6 +191,10 @@ func (l *Lexer) NextToken() token.Token {
 		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
+	case '?':
+		tok = newToken(token.QUESTION, l.ch)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -51,12 +203,28 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch;
+			l.readChar()
+			tok = token.Token{Type: token.PLUS_ASSIGN, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch;
+			l.readChar()
+			tok = token.Token{Type: token.MINUS_ASSIGN, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch;
@@ -66,74 +234,363 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch;
+			l.readChar()
+			tok = token.Token{Type: token.SLASH_ASSIGN, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch;
+			l.readChar()
+			tok = token.Token{Type: token.ASTERISK_ASSIGN, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch;
+			l.readChar()
+			tok = token.Token{Type: token.LT_EQ, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch;
+			l.readChar()
+			tok = token.Token{Type: token.GT_EQ, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			ch := l.ch;
+			l.readChar()
+			tok = token.Token{Type: token.AND, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+			l.report(diag.IllegalCharacter, start, l.peekPos(), "illegal character %q, did you mean &&?", l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			ch := l.ch;
+			l.readChar()
+			tok = token.Token{Type: token.OR, Literal: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '>' {
+			ch := l.ch;
+			l.readChar()
+			tok = token.Token{Type: token.PIPE, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+			l.report(diag.IllegalCharacter, start, l.peekPos(), "illegal character %q, did you mean || or |>?", l.ch)
+		}
+	case '"':
+		str, ok := l.readString()
+		if ok {
+			tok.Type = token.STRING
+			tok.Literal = str
+		} else {
+			tok.Type = token.ILLEGAL
+			tok.Literal = l.slice(start.Offset, l.pos().Offset) // Everything from the opening quote on
+			d := l.report(diag.UnterminatedString, start, l.pos(), "unterminated string literal")
+			d.Actual = token.EOF
+			d.Fixes = []diag.Fix{{
+				Message: "close the string with \"",
+				Span:    diag.Span{Start: l.pos(), End: l.pos()},
+				NewText: "\"",
+			}}
+		}
 	case 0:
+		if l.err != nil && !l.errReported { // This is where the input got cut off, not where it really ends
+			l.errReported = true
+			l.report(diag.ReadError, start, start, "error reading input: %s", l.err)
+		}
 		tok.Literal = ""
 		tok.Type = token.EOF
+		tok.End = start // Nothing to read past
+		return tok
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.End = l.pos()
 			return tok // Early return prevents the last 'l.readChar()' from happening, which in this case we want because l.readIdentifier() took care of that
-		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+		} else if isDigit(l.ch) || l.ch == '.' && isDigit(l.peekChar()) {
+			tok.Literal, tok.Type = l.readNumber()
+			tok.End = l.pos()
 			return tok
+		} else if l.ch == '.' && l.peekChar() == '.' && l.peekSecondChar() == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else if l.ch == utf8.RuneError && l.readPosition-l.position == 1 { // Not a real U+FFFD, just a byte that doesn't decode
+			tok = token.Token{Type: token.ILLEGAL, Literal: l.rawChar()}
+			l.report(diag.InvalidUTF8, start, l.peekPos(), "invalid UTF-8 encoding %q", l.rawChar())
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
+			l.report(diag.IllegalCharacter, start, l.peekPos(), "illegal character %q", l.ch)
 		}
 	}
 
 	l.readChar()
+	tok.Start = start // newToken() starts from scratch, so put the position and trivia back
+	tok.End = l.pos()
+	tok.Leading = comments
 	return tok
 
 }
 
-func (l *Lexer) readNumber() string {
+// Read a string literal, starting on the opening quote and stopping ON the closing one
+// We hand back the string with its escapes already decoded, and false if we hit the end of the input before the closing quote
+func (l *Lexer) readString() (string, bool) {
+	var out strings.Builder
+
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			return out.String(), true
+		case 0:
+			return out.String(), false
+		case '\\':
+			l.readEscape(&out)
+		default:
+			out.WriteString(l.rawChar()) // Copy the bytes over as they were, even if they aren't valid UTF-8
+		}
+	}
+}
+
+// Decode the escape sequence starting at the current backslash and write what it stands for into out
+// We leave l.ch on the last char of the escape, so readString carries on from the char after it
+func (l *Lexer) readEscape(out *strings.Builder) {
+	start := l.pos()
+	l.readChar()
+
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '"':
+		out.WriteByte('"')
+	case '\\':
+		out.WriteByte('\\')
+	case 'u':
+		l.readUnicodeEscape(out, start)
+	case 0:
+		return // Out of input - readString will report the unterminated string
+	default:
+		l.report(diag.InvalidEscape, start, l.peekPos(), "unknown escape sequence \\%c", l.ch)
+		out.WriteString(l.rawChar()) // Keep the char itself and drop the backslash
+	}
+}
+
+// Decode a \u{...} escape - one to six hex digits naming a Unicode code point
+func (l *Lexer) readUnicodeEscape(out *strings.Builder, start token.Position) {
+	if l.peekChar() != '{' {
+		l.report(diag.InvalidEscape, start, l.peekPos(), "expected { after \\u, escapes are written \\u{hex}")
+		return
+	}
+	l.readChar()
+
+	digits := ""
+	for isHexDigit(l.peekChar()) {
+		l.readChar()
+		digits += string(l.ch)
+	}
+
+	if l.peekChar() != '}' || len(digits) == 0 || len(digits) > 6 {
+		l.report(diag.InvalidEscape, start, l.peekPos(), "malformed unicode escape, escapes are written \\u{hex} with one to six hex digits")
+		return
+	}
+	l.readChar()
+
+	value, _ := strconv.ParseUint(digits, 16, 32) // Can't fail - at most six hex digits
+	if value > 0x10FFFF || (0xD800 <= value && value <= 0xDFFF) {
+		l.report(diag.InvalidEscape, start, l.peekPos(), "\\u{%s} is not a valid Unicode code point", digits)
+		return
+	}
+
+	out.WriteRune(rune(value))
+}
+
+// A fraction or an exponent is what turns an integer into a float
+// Every '.' followed by a digit gets swallowed, so 1.2.3 comes out as one token the parser can reject as a whole
+// Underscores are swallowed too - strconv knows where they are allowed, so the parser gets to decide whether 1__0 is okay
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
-	for isDigit(l.ch) { // Keep progressing until we do not see anymore digits
+	var tokType token.TokenType = token.INT
+	if l.ch == '0' && isBasePrefix(l.peekChar()) {
+		l.readChar()
+		l.readChar()
+		// Take every letter and digit, so a stray digit like the 2 in 0b102 is part of the bad literal rather than a new token
+		for isLetter(l.ch) || isDigit(l.ch) {
+			l.readChar()
+		}
+		return l.slice(position, l.position), tokType
+	}
+	for isDigit(l.ch) || l.ch == '_' { // Keep progressing until we do not see anymore digits
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	for l.ch == '.' && isDigit(l.peekChar()) {
+		tokType = token.FLOAT
+		l.readChar()
+		for isDigit(l.ch) || l.ch == '_' {
+			l.readChar()
+		}
+	}
+	if (l.ch == 'e' || l.ch == 'E') && l.exponentFollows() {
+		tokType = token.FLOAT
+		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+	return l.slice(position, l.position), tokType
 }
 
-func isDigit(ch byte) bool {
+// Sitting on an 'e', does it start an exponent? It does unless a letter comes straight after it, so 1else stays 1 followed by else
+// A malformed exponent like 1e or 1e+ is still taken as part of the number, so the parser can report the bad float instead of an unknown e
+func (l *Lexer) exponentFollows() bool {
+	return !isLetter(l.peekChar())
+}
+
+// The letter after a leading 0 that says which base an integer is written in: 0x, 0o or 0b
+func isBasePrefix(ch rune) bool {
+	switch ch {
+	case 'x', 'X', 'o', 'O', 'b', 'B':
+		return true
+	}
+	return false
+}
+
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+// Number literals stay ASCII - other scripts' digits are only allowed inside identifiers
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+// Whitespace is thrown away as we go, so the mark follows right behind us
 func (l *Lexer) skipWhitespace() {
+	l.mark = l.position
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		l.readChar()
+		l.mark = l.position
+	}
+}
+
+// Skip whitespace and comments up to the start of the next token, handing back the comments so they can be attached to it
+func (l *Lexer) skipTrivia() []token.Comment {
+	var comments []token.Comment
+
+	for {
+		l.skipWhitespace()
+
+		if l.ch != '/' {
+			return comments
+		}
+
+		switch l.peekChar() {
+		case '/':
+			comments = append(comments, l.readLineComment())
+		case '*':
+			comments = append(comments, l.readBlockComment())
+		default:
+			return comments // Just a slash
+		}
 	}
 }
 
+// A // comment runs up to (but not including) the end of the line
+func (l *Lexer) readLineComment() token.Comment {
+	start := l.pos()
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	return token.Comment{Text: l.slice(start.Offset, l.pos().Offset), Start: start, End: l.pos()}
+}
+
+// A /* */ comment may contain other /* */ comments, so we have to count how deep we are
+func (l *Lexer) readBlockComment() token.Comment {
+	start := l.pos()
+	depth := 0
+
+	for l.ch != 0 {
+		if l.ch == '/' && l.peekChar() == '*' {
+			depth += 1
+			l.readChar()
+		} else if l.ch == '*' && l.peekChar() == '/' {
+			depth -= 1
+			l.readChar()
+		}
+		l.readChar()
+
+		if depth == 0 {
+			return token.Comment{Text: l.slice(start.Offset, l.pos().Offset), Start: start, End: l.pos()}
+		}
+	}
+
+	d := l.report(diag.UnterminatedComment, start, l.pos(), "unterminated block comment")
+	d.Actual = token.EOF
+	d.Fixes = []diag.Fix{{
+		Message: "close the comment with " + strings.Repeat("*/", depth),
+		Span:    diag.Span{Start: l.pos(), End: l.pos()},
+		NewText: strings.Repeat("*/", depth),
+	}}
+
+	return token.Comment{Text: l.slice(start.Offset, l.pos().Offset), Start: start, End: l.pos()}
+}
+
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) { // Keep reading until we hit a non-letter in the name of this identifier
+	for isLetter(l.ch) || isUnicodeDigit(l.ch) { // Keep reading until we hit something that can't be part of the name of this identifier - digits are fine after the first char
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return l.slice(position, l.position)
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+func (l *Lexer) peekChar() rune {
+	if !l.ensure(l.readPosition + 1) {
 		return 0 // ASCII for null
 	} else {
-		return l.input[l.readPosition]
+		l.ensure(l.readPosition + utf8.UTFMax)
+		ch, _ := utf8.DecodeRune(l.buf[l.readPosition-l.base:])
+		return ch
 	}
 }
 
-func isLetter(ch byte) bool {
+// The character after peekChar() - only ever compared against ASCII, so we don't bother decoding it
+func (l *Lexer) peekSecondChar() rune {
+	if !l.ensure(l.readPosition + 2) {
+		return 0
+	}
+	return rune(l.buf[l.readPosition+1-l.base])
+}
+
+// Same rules as Go identifiers: a letter is anything Unicode calls a letter, plus the underscore
+func isLetter(ch rune) bool {
 	// THIS is the place to sneak in new character allowed for identifier names
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || ch >= utf8.RuneSelf && unicode.IsLetter(ch)
+}
+
+// Any Unicode decimal digit - only allowed after the first char of an identifier
+func isUnicodeDigit(ch rune) bool {
+	return isDigit(ch) || ch >= utf8.RuneSelf && unicode.IsDigit(ch)
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
\ No newline at end of file
@@ -6,8 +6,13 @@ package lexer
 // The type associated with our source code will be 'string'
 
 import (
+	"errors"
+	"io"
+	"strings"
 	"testing" // Go testing library
+	"testing/iotest"
 
+	"monkey/diag"
 	"monkey/token" // virtual package called 'monkey' (MUST BE LOWER CASE) - because that's what the go.mod file calls our virtual package in the outer 'My Code' directory
 )
 
@@ -21,7 +26,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -131,3 +136,756 @@ if (5 < 10) {
 	}
 
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x == 10\n"
+
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedStart token.Position
+		expectedEnd   token.Position
+	}{
+		{token.LET, token.Position{Line: 1, Column: 1, Offset: 0}, token.Position{Line: 1, Column: 4, Offset: 3}},
+		{token.IDENT, token.Position{Line: 1, Column: 5, Offset: 4}, token.Position{Line: 1, Column: 6, Offset: 5}},
+		{token.ASSIGN, token.Position{Line: 1, Column: 7, Offset: 6}, token.Position{Line: 1, Column: 8, Offset: 7}},
+		{token.INT, token.Position{Line: 1, Column: 9, Offset: 8}, token.Position{Line: 1, Column: 10, Offset: 9}},
+		{token.SEMICOLON, token.Position{Line: 1, Column: 10, Offset: 9}, token.Position{Line: 1, Column: 11, Offset: 10}},
+		{token.IDENT, token.Position{Line: 2, Column: 3, Offset: 13}, token.Position{Line: 2, Column: 4, Offset: 14}},
+		{token.EQ, token.Position{Line: 2, Column: 5, Offset: 15}, token.Position{Line: 2, Column: 7, Offset: 17}},
+		{token.INT, token.Position{Line: 2, Column: 8, Offset: 18}, token.Position{Line: 2, Column: 10, Offset: 20}},
+		{token.EOF, token.Position{Line: 3, Column: 1, Offset: 21}, token.Position{Line: 3, Column: 1, Offset: 21}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Start != tt.expectedStart {
+			t.Errorf("tests[%d] - start wrong. expected=%+v, got=%+v",
+				i, tt.expectedStart, tok.Start)
+		}
+
+		if tok.End != tt.expectedEnd {
+			t.Errorf("tests[%d] - end wrong. expected=%+v, got=%+v",
+				i, tt.expectedEnd, tok.End)
+		}
+	}
+}
+
+func TestTokenPositionFilename(t *testing.T) {
+	l := NewWithFilename("main.mk", "\n  foo")
+
+	tok := l.NextToken()
+	if tok.Start.String() != "main.mk:2:3" {
+		t.Errorf("tok.Start.String() wrong. expected=%q, got=%q",
+			"main.mk:2:3", tok.Start.String())
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"foobar"`, token.STRING, "foobar"},
+		{`"foo bar"`, token.STRING, "foo bar"},
+		{`""`, token.STRING, ""},
+		{`"a\nb\tc"`, token.STRING, "a\nb\tc"},
+		{`"say \"hi\""`, token.STRING, `say "hi"`},
+		{`"back\\slash"`, token.STRING, `back\slash`},
+		{`"\u{48}\u{49}"`, token.STRING, "HI"},
+		{`"\u{1F600}"`, token.STRING, "\U0001F600"},
+		{`"unterminated`, token.ILLEGAL, `"unterminated`},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Fatalf("tests[%d] - expected EOF after string. got=%q", i, next.Type)
+		}
+	}
+}
+
+func TestLexerDiagnostics(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedCode    diag.Code
+		expectedMessage string
+	}{
+		{`"abc`, diag.UnterminatedString, "1:1: unterminated string literal"},
+		{`"a\qb"`, diag.InvalidEscape, `1:3: unknown escape sequence \q`},
+		{`"\u0041"`, diag.InvalidEscape, `1:2: expected { after \u, escapes are written \u{hex}`},
+		{`"\u{zz}"`, diag.InvalidEscape, `1:2: malformed unicode escape, escapes are written \u{hex} with one to six hex digits`},
+		{`"\u{D800}"`, diag.InvalidEscape, `1:2: \u{D800} is not a valid Unicode code point`},
+		{`let @ = 1;`, diag.IllegalCharacter, `1:5: illegal character '@'`},
+		{`a & b`, diag.IllegalCharacter, `1:3: illegal character '&', did you mean &&?`},
+		{`a | b`, diag.IllegalCharacter, `1:3: illegal character '|', did you mean || or |>?`},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+
+		diagnostics := l.Diagnostics()
+		if len(diagnostics) != 1 {
+			t.Fatalf("tests[%d] - wrong number of diagnostics. want 1, got=%d (%v)",
+				i, len(diagnostics), diagnostics)
+		}
+
+		if diagnostics[0].Code != tt.expectedCode {
+			t.Errorf("tests[%d] - code wrong. expected=%q, got=%q",
+				i, tt.expectedCode, diagnostics[0].Code)
+		}
+
+		if diagnostics[0].String() != tt.expectedMessage {
+			t.Errorf("tests[%d] - message wrong. expected=%q, got=%q",
+				i, tt.expectedMessage, diagnostics[0].String())
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := `let größe = "Ünïcödé"; let 変数1 = größe; _x2 + αβγ;`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "größe"},
+		{token.ASSIGN, "="},
+		{token.STRING, "Ünïcödé"},
+		{token.SEMICOLON, ";"},
+		{token.LET, "let"},
+		{token.IDENT, "変数1"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "größe"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "_x2"},
+		{token.PLUS, "+"},
+		{token.IDENT, "αβγ"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	if len(l.Diagnostics()) != 0 {
+		t.Errorf("unexpected diagnostics: %v", l.Diagnostics())
+	}
+}
+
+func TestUnicodeColumns(t *testing.T) {
+	// é and 変 take two and three bytes, but only one column each
+	l := New(`"é変" x`)
+
+	str := l.NextToken()
+	if str.End.Column != 5 || str.End.Offset != 7 {
+		t.Errorf("string end wrong. want column 5 offset 7, got=%+v", str.End)
+	}
+
+	ident := l.NextToken()
+	if ident.Start.Column != 6 || ident.Start.Offset != 8 {
+		t.Errorf("ident start wrong. want column 6 offset 8, got=%+v", ident.Start)
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	l := New("x \xff y")
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x"},
+		{token.ILLEGAL, "\xff"},
+		{token.IDENT, "y"},
+		{token.EOF, ""},
+	}
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+
+	if len(l.Diagnostics()) != 1 || l.Diagnostics()[0].Code != diag.InvalidUTF8 {
+		t.Errorf("expected one %q diagnostic. got=%v", diag.InvalidUTF8, l.Diagnostics())
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+let x = 5; // trailing comment
+/* block
+   comment */ x / 2;
+/* outer /* inner */ still outer */ y;
+`
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedLiteral  string
+		expectedComments []string
+	}{
+		{token.LET, "let", []string{"// leading comment"}},
+		{token.IDENT, "x", nil},
+		{token.ASSIGN, "=", nil},
+		{token.INT, "5", nil},
+		{token.SEMICOLON, ";", nil},
+		{token.IDENT, "x", []string{"// trailing comment", "/* block\n   comment */"}},
+		{token.SLASH, "/", nil},
+		{token.INT, "2", nil},
+		{token.SEMICOLON, ";", nil},
+		{token.IDENT, "y", []string{"/* outer /* inner */ still outer */"}},
+		{token.SEMICOLON, ";", nil},
+		{token.EOF, "", nil},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if len(tok.Leading) != len(tt.expectedComments) {
+			t.Fatalf("tests[%d] - wrong number of comments. expected=%d, got=%d (%+v)",
+				i, len(tt.expectedComments), len(tok.Leading), tok.Leading)
+		}
+
+		for j, comment := range tt.expectedComments {
+			if tok.Leading[j].Text != comment {
+				t.Errorf("tests[%d] - comment %d wrong. expected=%q, got=%q",
+					i, j, comment, tok.Leading[j].Text)
+			}
+		}
+	}
+
+	if len(l.Diagnostics()) != 0 {
+		t.Errorf("unexpected diagnostics: %v", l.Diagnostics())
+	}
+}
+
+func TestCommentPositions(t *testing.T) {
+	l := New("x /* a */\n  // b\ny")
+
+	l.NextToken()
+	tok := l.NextToken()
+
+	if len(tok.Leading) != 2 {
+		t.Fatalf("wrong number of comments. expected=2, got=%d", len(tok.Leading))
+	}
+
+	block := tok.Leading[0]
+	if !block.IsBlock() || block.Start.String() != "1:3" || block.End.String() != "1:10" {
+		t.Errorf("block comment wrong. got=%+v", block)
+	}
+
+	line := tok.Leading[1]
+	if line.IsBlock() || line.Start.String() != "2:3" || line.End.String() != "2:7" {
+		t.Errorf("line comment wrong. got=%+v", line)
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	l := New("x /* never /* closed */")
+
+	l.NextToken()
+	tok := l.NextToken()
+
+	if tok.Type != token.EOF {
+		t.Fatalf("expected EOF. got=%q", tok.Type)
+	}
+	if len(tok.Leading) != 1 || tok.Leading[0].Text != "/* never /* closed */" {
+		t.Errorf("unterminated comment should still be kept. got=%+v", tok.Leading)
+	}
+
+	diagnostics := l.Diagnostics()
+	if len(diagnostics) != 1 || diagnostics[0].Code != diag.UnterminatedComment {
+		t.Fatalf("expected one %q diagnostic. got=%v", diag.UnterminatedComment, diagnostics)
+	}
+	if diagnostics[0].String() != "1:3: unterminated block comment" {
+		t.Errorf("message wrong. got=%q", diagnostics[0].String())
+	}
+	if diagnostics[0].Fixes[0].NewText != "*/" {
+		t.Errorf("fix wrong. got=%q", diagnostics[0].Fixes[0].NewText)
+	}
+}
+
+func TestBrackets(t *testing.T) {
+	input := `[1, 2][0];`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.LBRACKET, "["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestColon(t *testing.T) {
+	l := New(`{"foo": "bar"}`)
+
+	expected := []token.TokenType{token.LBRACE, token.STRING, token.COLON, token.STRING, token.RBRACE, token.EOF}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+}
+
+func TestComparisonAndLogicalOperators(t *testing.T) {
+	l := New("a <= b >= c && d || e % f < g > h")
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.AND, "&&"},
+		{token.IDENT, "d"},
+		{token.OR, "||"},
+		{token.IDENT, "e"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "f"},
+		{token.LT, "<"},
+		{token.IDENT, "g"},
+		{token.GT, ">"},
+		{token.IDENT, "h"},
+		{token.EOF, ""},
+	}
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestFloats(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{"3.14", token.FLOAT, "3.14"},
+		{".5", token.FLOAT, ".5"},
+		{"1e9", token.FLOAT, "1e9"},
+		{"1e-9", token.FLOAT, "1e-9"},
+		{"2.5E+3", token.FLOAT, "2.5E+3"},
+		{"1.2.3", token.FLOAT, "1.2.3"},
+		{"1e", token.FLOAT, "1e"}, // Bad, but all one token so the parser can say so
+		{"1E+", token.FLOAT, "1E+"},
+		{"42", token.INT, "42"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Fatalf("tests[%d] - expected EOF after the number. got=%q", i, next.Type)
+		}
+	}
+}
+
+func TestNumbersStopWhereTheyShould(t *testing.T) {
+	// The 'e' of else is not an exponent, and a dot without a digit after it is not a fraction
+	l := New("1else 1.")
+
+	expected := []token.TokenType{token.INT, token.ELSE, token.INT, token.ILLEGAL, token.EOF}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+}
+
+func TestIntegerBasesAndSeparators(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{"0xFF", token.INT, "0xFF"},
+		{"0o17", token.INT, "0o17"},
+		{"0b1010", token.INT, "0b1010"},
+		{"1_000_000", token.INT, "1_000_000"},
+		{"0xdead_beef", token.INT, "0xdead_beef"},
+		{"0x1e5", token.INT, "0x1e5"}, // Hex digits, not an exponent
+		{"0b102", token.INT, "0b102"}, // Bad, but all one token so the parser can say so
+		{"1_000.5", token.FLOAT, "1_000.5"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Fatalf("tests[%d] - expected EOF after the number. got=%q", i, next.Type)
+		}
+	}
+}
+
+func TestLoopKeywords(t *testing.T) {
+	l := New("while for break continue whilst")
+
+	expected := []token.TokenType{token.WHILE, token.FOR, token.BREAK, token.CONTINUE, token.IDENT, token.EOF}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	l := New("x += 1; x -= 2; x *= 3; x /= 4; x = 5")
+
+	expected := []token.TokenType{
+		token.IDENT, token.PLUS_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.MINUS_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.ASTERISK_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.SLASH_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.ASSIGN, token.INT, token.EOF,
+	}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+}
+
+func TestEllipsis(t *testing.T) {
+	l := New("fn(a, ...rest) {} .5 ..")
+
+	expected := []struct {
+		expectedType	token.TokenType
+		expectedLiteral	string
+	}{
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.FLOAT, ".5"},
+		{token.ILLEGAL, "."},
+		{token.ILLEGAL, "."},
+		{token.EOF, ""},
+	}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestQuestionMark(t *testing.T) {
+	l := New("a ? b : c")
+
+	expected := []token.TokenType{token.IDENT, token.QUESTION, token.IDENT, token.COLON, token.IDENT, token.EOF}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+}
+
+func TestPipe(t *testing.T) {
+	l := New("xs |> map(f) || ok | >")
+
+	expected := []struct {
+		expectedType	token.TokenType
+		expectedLiteral	string
+	}{
+		{token.IDENT, "xs"},
+		{token.PIPE, "|>"},
+		{token.IDENT, "map"},
+		{token.LPAREN, "("},
+		{token.IDENT, "f"},
+		{token.RPAREN, ")"},
+		{token.OR, "||"},
+		{token.IDENT, "ok"},
+		{token.ILLEGAL, "|"},
+		{token.GT, ">"},
+		{token.EOF, ""},
+	}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+// Lexing from a reader has to give exactly the same tokens and diagnostics as lexing the string, however the reader chops up the input
+func TestReaderMatchesString(t *testing.T) {
+	input := `// leading comment
+let größe = 0x_FF + 1_000.5e-3; /* nested /* block */ comment */
+let s = "tab\there \u{1F600} 😀 \q";
+fn add(a, b = 2, ...rest) { a |> f(b) ? a <= b : a >= b && !c || d }
+x += 1; y %= 2 \xff € & .5 1.2.3
+` + "\xff\xfe 😀\n" + `"unterminated`
+
+	readers := map[string]func() io.Reader{
+		"one byte":  func() io.Reader { return iotest.OneByteReader(strings.NewReader(input)) },
+		"half":      func() io.Reader { return iotest.HalfReader(strings.NewReader(input)) },
+		"data+EOF":  func() io.Reader { return iotest.DataErrReader(strings.NewReader(input)) },
+		"whole":     func() io.Reader { return strings.NewReader(input) },
+	}
+
+	for name, reader := range readers {
+		expected := NewWithFilename("test.mk", input)
+		l := NewReaderWithFilename("test.mk", reader())
+
+		for i := 0; ; i++ {
+			want := expected.NextToken()
+			got := l.NextToken()
+
+			if got.Type != want.Type || got.Literal != want.Literal || got.Start != want.Start || got.End != want.End {
+				t.Fatalf("%s: token %d wrong. want %s %q %s..%s, got=%s %q %s..%s", name, i,
+					want.Type, want.Literal, want.Start, want.End, got.Type, got.Literal, got.Start, got.End)
+			}
+			if len(got.Leading) != len(want.Leading) {
+				t.Fatalf("%s: token %d has %d comments, want %d", name, i, len(got.Leading), len(want.Leading))
+			}
+			for j := range want.Leading {
+				if got.Leading[j] != want.Leading[j] {
+					t.Fatalf("%s: comment %d of token %d wrong. want %+v, got=%+v", name, j, i, want.Leading[j], got.Leading[j])
+				}
+			}
+
+			if want.Type == token.EOF {
+				break
+			}
+		}
+
+		if len(l.Diagnostics()) != len(expected.Diagnostics()) {
+			t.Fatalf("%s: wrong number of diagnostics. want %d, got=%d", name, len(expected.Diagnostics()), len(l.Diagnostics()))
+		}
+		for i, d := range expected.Diagnostics() {
+			if l.Diagnostics()[i].String() != d.String() {
+				t.Errorf("%s: diagnostic %d wrong. want %q, got=%q", name, i, d.String(), l.Diagnostics()[i].String())
+			}
+		}
+		if l.Err() != nil {
+			t.Errorf("%s: unexpected read error %v", name, l.Err())
+		}
+	}
+}
+
+// Produces the same statement over and over, without ever having all of it in memory
+type repeatReader struct {
+	line	string
+	count	int
+	offset	int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && r.count > 0 {
+		copied := copy(p[n:], r.line[r.offset:])
+		n += copied
+		r.offset += copied
+		if r.offset == len(r.line) {
+			r.offset = 0
+			r.count -= 1
+		}
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func TestReaderBuffering(t *testing.T) {
+	line := "let x = x + 1; // keep counting\n"
+	count := 100000 // About 3MB of source
+	l := NewReader(&repeatReader{line: line, count: count})
+
+	tokens := 0
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		tokens++
+	}
+
+	if tokens != 7*count {
+		t.Fatalf("wrong number of tokens. want %d, got=%d", 7*count, tokens)
+	}
+	if cap(l.buf) > readSize {
+		t.Errorf("buffer grew to %d bytes for tokens that all fit in %d", cap(l.buf), readSize)
+	}
+
+	// A single token bigger than the buffer has to fit in it whole
+	long := strings.Repeat("a", 3*readSize)
+	l = NewReader(iotest.HalfReader(strings.NewReader("x " + long + " y")))
+	expected := []string{"x", long, "y", ""}
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok.Literal != want {
+			t.Fatalf("tests[%d] - literal wrong. want %d bytes, got=%d", i, len(want), len(tok.Literal))
+		}
+	}
+}
+
+func TestReaderError(t *testing.T) {
+	failure := errors.New("connection reset")
+	l := NewReaderWithFilename("net.mk", io.MultiReader(strings.NewReader("let x\n= 5"), iotest.ErrReader(failure)))
+
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.EOF, token.EOF}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+
+	if l.Err() != failure {
+		t.Errorf("l.Err() wrong. want %v, got=%v", failure, l.Err())
+	}
+
+	// Reported once, right where the input stopped
+	diagnostics := l.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic. got=%v", diagnostics)
+	}
+	if diagnostics[0].Code != diag.ReadError {
+		t.Errorf("diagnostic code wrong. want %q, got=%q", diag.ReadError, diagnostics[0].Code)
+	}
+	if diagnostics[0].String() != "net.mk:2:4: error reading input: connection reset" {
+		t.Errorf("diagnostic wrong. got=%q", diagnostics[0].String())
+	}
+}
+
+// Always comes back empty-handed, which the io.Reader docs discourage but allow
+type stuckReader struct{}
+
+func (stuckReader) Read(p []byte) (int, error) { return 0, nil }
+
+func TestReaderNoProgress(t *testing.T) {
+	l := NewReader(stuckReader{})
+
+	tok := l.NextToken()
+	if tok.Type != token.EOF {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.EOF, tok.Type)
+	}
+	if l.Err() != io.ErrNoProgress {
+		t.Errorf("l.Err() wrong. want %v, got=%v", io.ErrNoProgress, l.Err())
+	}
+}
@@ -1,13 +1,48 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
+	"monkey/ast"
+	"monkey/astdot"
+	"monkey/astjson"
+	"monkey/format"
+	"monkey/lexer"
+	"monkey/parser"
 	"monkey/repl"
 )
 
+var engine = flag.String("engine", repl.ENGINE_VM, "how to run programs: '"+repl.ENGINE_VM+"' (bytecode virtual machine) or '"+repl.ENGINE_EVAL+"' (tree-walking evaluator)")
+var astJSON = flag.String("ast-json", "", "parse the given file ('-' for stdin) and print its syntax tree as JSON instead of starting the REPL")
+var astDOT = flag.String("dot", "", "parse the given file ('-' for stdin) and print its syntax tree as a Graphviz DOT graph instead of starting the REPL")
+
 func main() {
+	flag.Parse()
+
+	if *astJSON != "" {
+		os.Exit(dumpAST(*astJSON, func(program *ast.Program) (string, error) {
+			data, err := astjson.MarshalIndent(program, "", "  ")
+			return string(data) + "\n", err
+		}))
+	}
+	if *astDOT != "" {
+		os.Exit(dumpAST(*astDOT, func(program *ast.Program) (string, error) {
+			return astdot.Graph(program), nil
+		}))
+	}
+
+	if flag.Arg(0) == "fmt" {
+		os.Exit(runFmt(flag.Args()[1:]))
+	}
+
+	if *engine != repl.ENGINE_VM && *engine != repl.ENGINE_EVAL {
+		fmt.Fprintf(os.Stderr, "unknown engine %q\n", *engine)
+		os.Exit(2)
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -15,5 +50,99 @@ func main() {
 	fmt.Printf("Hello %s! This is the Monkey programming language!\n",
 		user.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
-}
\ No newline at end of file
+	repl.StartWithEngine(os.Stdin, os.Stdout, *engine)
+}
+
+// monkey fmt [-w] [-l] [file ...] - print the files in canonical form, or whatever comes in on stdin if there are none
+// Hands back the exit status: 1 if any file couldn't be read or parsed, 2 for bad flags
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the result back to the file instead of printing it")
+	list := flags.Bool("l", false, "only list the files whose formatting differs")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		formatted, err := format.Source("<stdin>", string(src))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Print(formatted)
+		return 0
+	}
+
+	status := 0
+	for _, filename := range flags.Args() {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		formatted, err := format.Source(filename, string(src))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		changed := formatted != string(src)
+		if *list && changed {
+			fmt.Println(filename)
+		}
+		if *write {
+			if changed {
+				if err := os.WriteFile(filename, []byte(formatted), 0644); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					status = 1
+				}
+			}
+		} else if !*list {
+			fmt.Print(formatted)
+		}
+	}
+	return status
+}
+
+// -ast-json and -dot - print the tree the parser builds for a file, in whatever shape dump turns it into
+// The tree is printed even when there are syntax errors (they show up as BadStatement nodes), but then we exit with 1
+func dumpAST(filename string, dump func(*ast.Program) (string, error)) int {
+	var l *lexer.Lexer
+	if filename == "-" {
+		l = lexer.NewReaderWithFilename("<stdin>", os.Stdin)
+	} else {
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		l = lexer.NewReaderWithFilename(filename, f)
+	}
+
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	out, err := dump(program)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Print(out)
+
+	if len(p.Errors()) != 0 {
+		for _, e := range p.Errors() {
+			fmt.Fprintln(os.Stderr, e)
+		}
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,47 @@
+package object
+
+// An environment maps names to the values they were bound to with let
+// Every function call gets its own environment that wraps (encloses) the one the function was defined in
+type Environment struct {
+	store map[string]Object
+	outer *Environment // nil for the outermost (global) environment
+}
+
+func NewEnvironment() *Environment {
+	s := make(map[string]Object)
+	return &Environment{store: s, outer: nil}
+}
+
+// A fresh environment whose lookups fall back to the given one
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// Look a name up here, then in each enclosing environment in turn
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+// Rebind a name where it already lives, which may be an enclosing environment - reports false if it isn't bound anywhere
+func (e *Environment) Assign(name string, val Object) bool {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = val
+		return true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+	return false
+}
+
+// Bind a name in this environment - shadows any binding of the same name further out
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name] = val
+	return val
+}
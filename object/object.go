@@ -0,0 +1,256 @@
+package object
+
+// Every value we produce while evaluating a Monkey program is represented by something implementing the Object interface
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"monkey/ast"
+	"monkey/code"
+	"strconv"
+	"strings"
+)
+
+type ObjectType string // A string again, so it is easy to print while debugging
+
+const (
+	INTEGER_OBJ		= "INTEGER"
+	FLOAT_OBJ		= "FLOAT"
+	STRING_OBJ		= "STRING"
+	BOOLEAN_OBJ		= "BOOLEAN"
+	NULL_OBJ		= "NULL"
+	RETURN_VALUE_OBJ	= "RETURN_VALUE"
+	BREAK_OBJ		= "BREAK"
+	CONTINUE_OBJ	= "CONTINUE"
+	ERROR_OBJ		= "ERROR"
+	FUNCTION_OBJ	= "FUNCTION"
+	ARRAY_OBJ		= "ARRAY"
+	HASH_OBJ		= "HASH"
+	COMPILED_FUNCTION_OBJ	= "COMPILED_FUNCTION"
+	CLOSURE_OBJ		= "CLOSURE"
+	CELL_OBJ		= "CELL"
+)
+
+type Object interface {
+	// What kind of value is this?
+	Type() ObjectType
+	// What the REPL shows for this value
+	Inspect() string
+}
+
+// Wraps a Go int64
+type Integer struct {
+	Value int64
+}
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+
+// Wraps a Go float64
+type Float struct {
+	Value float64
+}
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	out := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	// Whole floats still get a decimal point, so 3.0 doesn't pass itself off as the integer 3
+	if !strings.ContainsAny(out, ".eIN") {
+		out += ".0"
+	}
+	return out
+}
+
+// Wraps a Go string
+type String struct {
+	Value string
+}
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+// Wraps a Go bool - the evaluator only ever hands out two of these
+type Boolean struct {
+	Value bool
+}
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+
+// The absence of a value - e.g. what an if expression without an else produces when its condition is false
+type Null struct{}
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "null" }
+
+// Wraps the value of a return statement so the evaluator knows to stop evaluating the enclosing statements
+type ReturnValue struct {
+	Value Object
+}
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+// What a break statement evaluates to - like a return value it stops the enclosing statements, but only until the innermost loop sees it
+type Break struct{}
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+// What a continue statement evaluates to - the innermost loop moves straight on to its next pass
+type Continue struct{}
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+// Something went wrong at runtime - like a return value, it stops evaluation dead in its tracks
+type Error struct {
+	Message string
+}
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+
+// A function value - it carries the environment it was defined in, which is what makes closures work
+type Function struct {
+	Parameters	[]*ast.Parameter
+	Body		*ast.BlockStatement
+	Env			*Environment
+	Name		string // Empty for an anonymous function
+}
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn")
+	if f.Name != "" {
+		out.WriteString(" " + f.Name)
+	}
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(f.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// An ordered list of values - any mix of types
+type Array struct {
+	Elements []Object
+}
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// What a value is filed under in a hash - two values with equal contents must give equal keys
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Only some objects can be used as hash keys
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+
+	if b.Value {
+		value = 1
+	} else {
+		value = 0
+	}
+
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+// We keep the original key object around next to the value, so we can still print the hash
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+type Hash struct {
+	Pairs map[HashKey]HashPair
+}
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, fmt.Sprintf("%s: %s",
+			pair.Key.Inspect(), pair.Value.Inspect()))
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// What the compiler turns a function literal into - it lives in the constant pool
+type CompiledFunction struct {
+	Instructions	code.Instructions
+	NumLocals		int // How many stack slots to reserve for let bindings and parameters
+	NumParameters	int // Not counting a rest parameter
+	NumRequired		int // The parameters without a default value
+	Variadic		bool // Whether there is a rest parameter - it gets the local slot right after the others
+	Name			string // Empty for an anonymous function
+}
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	if cf.Name != "" {
+		return fmt.Sprintf("CompiledFunction<%s>[%p]", cf.Name, cf)
+	}
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// The VM's function value - a compiled function plus the free variables it captured when it was created
+type Closure struct {
+	Fn		*CompiledFunction
+	Free	[]Object
+}
+func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	if c.Fn.Name != "" {
+		return fmt.Sprintf("Closure<%s>[%p]", c.Fn.Name, c)
+	}
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// A variable the VM shares between the function that declared it and the closures that captured it, so an assignment in one is seen by all
+// Only ever sits in a local slot or a closure's free variables - reading the variable reads what is inside
+type Cell struct {
+	Value	Object // Nil until the variable is bound
+}
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string {
+	if c.Value == nil {
+		return "Cell[]"
+	}
+	return fmt.Sprintf("Cell[%s]", c.Value.Inspect())
+}
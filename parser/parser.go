@@ -2,7 +2,9 @@ package parser
 
 import (
 	"fmt"
+	"math"
 	"monkey/ast"
+	"monkey/diag"
 	"monkey/lexer"
 	"monkey/token"
 	"strconv"
@@ -13,31 +15,50 @@ var print_trace = false
 const (
 	_ int = iota // Give the following constants incrementing numbers as values
 	LOWEST
+	ASSIGNMENT	// = or += and friends
+	TERNARY		// cond ? a : b
+	LOGICAL_OR	// ||
+	LOGICAL_AND	// &&
+	PIPELINE	// |>
 	EQUALS		// ==
-	LESSGREATER // > or <
+	LESSGREATER // > or < or >= or <=
 	SUM			// +
-	PRODUCT		// *
+	PRODUCT		// * or / or %
 	PREFIX		// -X or !X
 	CALL		// myFunction(X)
+	INDEX		// array[index]
 	// Establishes order of operations
 )
 
 var precedences = map[token.TokenType]int{
+	token.ASSIGN:			ASSIGNMENT,
+	token.PLUS_ASSIGN:		ASSIGNMENT,
+	token.MINUS_ASSIGN:		ASSIGNMENT,
+	token.ASTERISK_ASSIGN:	ASSIGNMENT,
+	token.SLASH_ASSIGN:		ASSIGNMENT,
+	token.QUESTION:	TERNARY,
+	token.OR:		LOGICAL_OR,
+	token.AND:		LOGICAL_AND,
+	token.PIPE:		PIPELINE,
 	token.EQ:		EQUALS,
 	token.NOT_EQ:	EQUALS,
 	token.LT:		LESSGREATER,
 	token.GT:		LESSGREATER,
+	token.LT_EQ:	LESSGREATER,
+	token.GT_EQ:	LESSGREATER,
 	token.PLUS:		SUM,
 	token.MINUS:	SUM,
 	token.SLASH:	PRODUCT,
 	token.ASTERISK:	PRODUCT,
+	token.PERCENT:	PRODUCT,
 	token.LPAREN:   CALL,
+	token.LBRACKET: INDEX,
 }
 
 type Parser struct {
 	l *lexer.Lexer
 
-	errors []string
+	diagnostics []diag.Diagnostic // Everything that went wrong while parsing, in the order we found it
 
 	curToken token.Token // Current token under examination
 	peekToken token.Token // The next token to be read, which we may need to know if curToken does not give us enough information
@@ -46,6 +67,15 @@ type Parser struct {
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns map[token.TokenType]infixParseFn
+
+	lexerDiagnostics int // How many of the lexer's diagnostics we have already copied into ours
+
+	comments []token.Comment // Everything the lexer skipped over as trivia so far - ends up in Program.Comments
+
+	depth int // How many braces are open at curToken - lets recovery tell a closing brace of its own statement from the one closing the enclosing block
+	panicking bool // Set when we report an error, cleared once we have skipped ahead to a point where parsing can pick back up
+
+	loopDepth int // How many loop bodies enclose curToken within the current function - break and continue need at least one
 }
 
 // Map the given tokenType to the given prefix function
@@ -80,13 +110,16 @@ func (p *Parser) curPrecedence() int {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:	 	l,
-		errors:	[]string{},
+		diagnostics:	[]diag.Diagnostic{},
 	}
 
 	// Make the map of prefix functions and throw in the functions for various tokens
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
@@ -94,6 +127,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral) // Blocks only ever follow 'if', 'else' or a parameter list, so a '{' where an expression should start is always a hash
 
 	// Make the map of infix functions and throw in the functions
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
@@ -101,11 +136,24 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseLogicalExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.OR, p.parseLogicalExpression)
+	p.registerInfix(token.QUESTION, p.parseConditionalExpression)
+	p.registerInfix(token.PIPE, p.parsePipeExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
@@ -117,80 +165,247 @@ func New(l *lexer.Lexer) *Parser {
 // Parse a call expression
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseCallArguments()
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if exp.Arguments != nil {
+		exp.Rparen = p.curToken // parseExpressionList leaves us sitting on the ')'
+	}
 	return exp
 }
 
-// Parse the arguments to a call
-func (p *Parser) parseCallArguments() []ast.Expression {
-	args := []ast.Expression{}
+// Parse an array literal
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements != nil {
+		array.Rbracket = p.curToken
+	}
+	return array
+}
+
+// Parse a hash literal - a comma separated list of key: value pairs
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+	hash.Pairs = []ast.HashPair{}
 
-	if p.peekTokenIs(token.RPAREN) { // no arguments
+	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
-		return args
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	hash.Rbrace = p.curToken
+
+	return hash
+}
+
+// Parse an index expression - the left side is whatever we are indexing into
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	exp.Rbracket = p.curToken
+
+	return exp
+}
+
+// Parse a comma separated list of expressions up to the given closing token - shared by call arguments and array elements
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) { // empty list
+		p.nextToken()
+		return list
 	}
 
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	list = append(list, p.parseExpression(LOWEST))
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		list = append(list, p.parseExpression(LOWEST))
 	}
 
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectPeek(end) {
 		return nil
 	}
 
-	return args
+	return list
 }
 
 // Parse a function literal
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 
-	if !p.expectPeek(token.LPAREN) {
+	if !p.parseFunctionSignatureAndBody(lit) {
 		return nil
 	}
 
+	return lit
+}
+
+// fn name(params) { body } - only allowed as a statement, since the point is to bind the name
+func (p *Parser) parseFunctionStatement() ast.Statement {
+	stmt := &ast.FunctionStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	stmt.Function = &ast.FunctionLiteral{Token: stmt.Token, Name: stmt.Name.Value}
+
+	if !p.parseFunctionSignatureAndBody(stmt.Function) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// The part a function literal and a function declaration have in common, from the ( of the parameters to the closing }
+func (p *Parser) parseFunctionSignatureAndBody(lit *ast.FunctionLiteral) bool {
+	if !p.expectPeek(token.LPAREN) {
+		return false
+	}
+
+	// A function starts out of any loop, default values included - a break in there can't jump out of the function to a loop around it
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = loopDepth }()
+
 	lit.Parameters = p.parseFunctionParameters()
 
 	if !p.expectPeek(token.LBRACE) {
-		return nil
+		return false
 	}
 
 	lit.Body = p.parseBlockStatement()
 
-	return lit
+	return true
 }
 
-// Parse the parameters of a function literal
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// Parse the parameters of a function literal, e.g. (a, b = 2, ...rest) - a trailing comma is fine
+// Required parameters come first, then the ones with defaults, then at most one rest parameter
+func (p *Parser) parseFunctionParameters() []*ast.Parameter {
+	params := []*ast.Parameter{}
+	seen := map[string]bool{}
 
-	if p.peekTokenIs(token.RPAREN) { // no identifiers
+	for !p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
-	}
 
-	p.nextToken()
+		param := p.parseParameter()
+		if param == nil {
+			return nil
+		}
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
+		if seen[param.Name.Value] {
+			p.report(diag.Diagnostic{
+				Severity: diag.Error,
+				Code:     diag.DuplicateParameter,
+				Message:  fmt.Sprintf("duplicate parameter %s", param.Name.Value),
+				Span:     diag.TokenSpan(param.Name.Token),
+				Actual:   token.IDENT,
+			})
+			return nil
+		}
+		seen[param.Name.Value] = true
+
+		if len(params) > 0 {
+			previous := params[len(params)-1]
+			if previous.Rest {
+				p.parameterError(param, fmt.Sprintf("...%s must be the last parameter", previous.Name.Value))
+				return nil
+			}
+			if previous.Default != nil && param.Default == nil && !param.Rest {
+				p.parameterError(param, fmt.Sprintf("required parameter %s can't follow %s, which has a default value", param.Name.Value, previous.Name.Value))
+				return nil
+			}
+		}
 
-	for p.peekTokenIs(token.COMMA) { // another identifier to read
-		p.nextToken()
+		params = append(params, param)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
 	}
 
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
 
-	return identifiers
+	return params
+}
+
+// Parse a single parameter, starting on its name or on the ... of a rest parameter
+func (p *Parser) parseParameter() *ast.Parameter {
+	param := &ast.Parameter{Token: p.curToken}
+
+	if p.curTokenIs(token.ELLIPSIS) {
+		param.Rest = true
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+	} else if !p.curTokenIs(token.IDENT) {
+		p.report(diag.Diagnostic{
+			Severity: diag.Error,
+			Code:     diag.UnexpectedToken,
+			Message:  fmt.Sprintf("expected a parameter name, got %s instead", p.curToken.Type),
+			Span:     diag.TokenSpan(p.curToken),
+			Expected: []token.TokenType{token.IDENT},
+			Actual:   p.curToken.Type,
+		})
+		return nil
+	}
+
+	param.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.ASSIGN) {
+		if param.Rest {
+			p.nextToken()
+			p.parameterError(param, fmt.Sprintf("...%s can't have a default value, it is an empty array when no arguments are left over", param.Name.Value))
+			return nil
+		}
+		p.nextToken()
+		p.nextToken()
+		param.Default = p.parseExpression(LOWEST)
+		if param.Default == nil {
+			return nil
+		}
+	}
+
+	return param
+}
+
+func (p *Parser) parameterError(param *ast.Parameter, message string) {
+	p.report(diag.Diagnostic{
+		Severity: diag.Error,
+		Code:     diag.InvalidParameter,
+		Message:  message,
+		Span:     diag.Span{Start: param.Pos(), End: param.End()},
+		Actual:   param.Token.Type,
+	})
 }
 
 // Parse an if expression
@@ -214,16 +429,78 @@ func (p *Parser) parseIfExpression() ast.Expression {
 
 	expression.Consequence = p.parseBlockStatement()
 
-	if p.peekTokenIs(token.ELSE) {
+	for p.peekTokenIs(token.ELSE) {
 		p.nextToken()
 
+		// 'else if' adds another link to the chain rather than nesting a whole new if inside a block
+		if p.peekTokenIs(token.IF) {
+			elseIf := &ast.ElseIf{Token: p.curToken}
+			p.nextToken()
+
+			if !p.expectPeek(token.LPAREN) {
+				return nil
+			}
+
+			p.nextToken()
+			elseIf.Condition = p.parseExpression(LOWEST)
+
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+
+			if !p.expectPeek(token.LBRACE) {
+				return nil
+			}
+
+			elseIf.Consequence = p.parseBlockStatement()
+			expression.ElseIfs = append(expression.ElseIfs, elseIf)
+			continue
+		}
+
 		if !p.expectPeek(token.LBRACE) {
 			return nil
 		}
 
 		expression.Alternative = p.parseBlockStatement()
+		break
+	}
+
+	return expression
+}
+
+// x |> f(a) - kept as its own node rather than rewritten into f(x, a), so it can be printed back the way it was written
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	expression := &ast.PipeExpression{
+		Token: p.curToken,
+		Left: left,
 	}
 
+	// Our own precedence, so xs |> f |> g groups as (xs |> f) |> g
+	p.nextToken()
+	expression.Right = p.parseExpression(PIPELINE)
+
+	return expression
+}
+
+// cond ? a : b
+func (p *Parser) parseConditionalExpression(condition ast.Expression) ast.Expression {
+	expression := &ast.ConditionalExpression{
+		Token: p.curToken,
+		Condition: condition,
+	}
+
+	// Anything goes between ? and :, the colon closes it off just like a parenthesis would
+	p.nextToken()
+	expression.Consequence = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+
+	// One below our own precedence so a ? b : c ? d : e groups as a ? b : (c ? d : e)
+	p.nextToken()
+	expression.Alternative = p.parseExpression(TERNARY - 1)
+
 	return expression
 }
 
@@ -231,6 +508,7 @@ func (p *Parser) parseIfExpression() ast.Expression {
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
+	depth := p.depth // The depth inside this block
 
 	p.nextToken()
 
@@ -239,8 +517,15 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
+		if p.depth < depth { // Recovering from a broken statement left us on our own closing brace
+			break
+		}
 		p.nextToken()
 	}
+	block.Rbrace = p.curToken // Either the closing } or EOF if the block was never closed
+	if p.curTokenIs(token.EOF) {
+		p.expectedError(token.RBRACE, p.curToken)
+	}
 
 	return block
 }
@@ -263,6 +548,16 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+// The lexer has already reported what is wrong with an ILLEGAL token, so all we do is go into panic mode without piling on a second message
+func (p *Parser) parseIllegal() ast.Expression {
+	p.panicking = true
+	return nil
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
@@ -307,20 +602,167 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// Same shape as an infix expression, but it gets its own node so later stages know to short-circuit
+func (p *Parser) parseLogicalExpression(left ast.Expression) ast.Expression {
+	if print_trace {
+		defer untrace(trace("parseLogicalExpression"))
+	}
+
+	expression := &ast.LogicalExpression{
+		Token: p.curToken,
+		Operator: p.curToken.Literal,
+		Left: left,
+	}
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+
+	expression.Right = p.parseExpression(precedence)
+
+	return expression
+}
+
+// Assignment is right-associative: x = y = 1 assigns 1 to y first, and then the result of that to x
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	if print_trace {
+		defer untrace(trace("parseAssignExpression"))
+	}
+
+	switch left.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		p.report(diag.Diagnostic{
+			Severity: diag.Error,
+			Code:     diag.InvalidAssignmentTarget,
+			Message:  fmt.Sprintf("cannot assign to %s, only to a name or an index expression", left.String()),
+			Span:     diag.Span{Start: left.Pos(), End: left.End()},
+			Actual:   p.curToken.Type,
+		})
+		return nil
+	}
+
+	expression := &ast.AssignExpression{
+		Token: p.curToken,
+		Operator: p.curToken.Literal,
+		Target: left,
+	}
+
+	p.nextToken()
+
+	// One below our own precedence, so another assignment on the right binds before we do
+	expression.Value = p.parseExpression(ASSIGNMENT - 1)
+
+	return expression
+}
+
+// The errors we ran into, formatted as "line:column: message" - kept around for callers that just want to print them
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := []string{}
+	for _, d := range p.diagnostics {
+		if d.Severity == diag.Error {
+			errors = append(errors, d.String())
+		}
+	}
+	return errors
+}
+
+// Everything the parser has to say about the input, with codes, spans and hints attached
+func (p *Parser) Diagnostics() []diag.Diagnostic {
+	return p.diagnostics
+}
+
+// Copy over anything the lexer reported while producing the token we just read
+// Lexer errors are not knock-on effects of parse errors, so they are never swallowed in panic mode
+func (p *Parser) collectLexerDiagnostics() {
+	lexed := p.l.Diagnostics()
+	for ; p.lexerDiagnostics < len(lexed); p.lexerDiagnostics++ {
+		p.diagnostics = append(p.diagnostics, lexed[p.lexerDiagnostics])
+	}
+}
+
+// Record a diagnostic and go into panic mode
+// While panicking, further errors are almost always knock-on effects of the first one, so we swallow them until we resynchronise
+func (p *Parser) report(d diag.Diagnostic) {
+	if p.panicking {
+		return
+	}
+	p.diagnostics = append(p.diagnostics, d)
+	p.panicking = true
+}
+
+// Skip tokens until we reach a point where a new statement can start - the statement that failed started at the given brace depth
+// We stop ON a semicolon or a closing brace of the failed statement (the caller's nextToken() moves past it),
+// just BEFORE a 'let', a 'return' or the closing brace of the enclosing block, or on that closing brace if we already ran into it
+func (p *Parser) synchronize(depth int) {
+	for !p.curTokenIs(token.EOF) {
+		if p.depth < depth { // We are sitting on the brace that closes the enclosing block - leave it for the block
+			break
+		}
+		if p.depth == depth {
+			if p.curTokenIs(token.SEMICOLON) || p.curTokenIs(token.RBRACE) {
+				break
+			}
+			if p.peekTokenIs(token.LET) || p.peekTokenIs(token.RETURN) || p.peekTokenIs(token.WHILE) || p.peekTokenIs(token.FOR) || p.peekTokenIs(token.RBRACE) {
+				break
+			}
+		}
+		p.nextToken()
+	}
+
+	p.panicking = false
 }
 
 // Report an error where the next token should have been the given token type but was something else
 func (p *Parser) PeekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
-		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.expectedError(t, p.peekToken)
+}
+
+// We needed a t, but got tok instead
+func (p *Parser) expectedError(t token.TokenType, tok token.Token) {
+	d := diag.Diagnostic{
+		Severity: diag.Error,
+		Code:     diag.UnexpectedToken,
+		Message:  fmt.Sprintf("expected next token to be %s, got %s instead", t, tok.Type),
+		Span:     diag.TokenSpan(tok),
+		Expected: []token.TokenType{t},
+		Actual:   tok.Type,
+	}
+
+	// Punctuation has exactly one spelling, so we can suggest putting it in
+	if isPunctuation(t) {
+		d.Fixes = []diag.Fix{{
+			Message: fmt.Sprintf("insert %s before %s", t, tok.Type),
+			Span:    diag.Span{Start: tok.Start, End: tok.Start},
+			NewText: string(t),
+		}}
+	}
+
+	p.report(d)
+}
+
+// Token types whose name is also their only spelling
+func isPunctuation(t token.TokenType) bool {
+	switch t {
+	case token.ASSIGN, token.COMMA, token.SEMICOLON, token.LPAREN, token.RPAREN, token.LBRACE, token.RBRACE, token.LBRACKET, token.RBRACKET, token.COLON, token.QUESTION:
+		return true
+	}
+	return false
 }
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken // Still null the first time this function is called - that's why we call it twice above
 	p.peekToken = p.l.NextToken()
+	p.comments = append(p.comments, p.peekToken.Leading...)
+	p.collectLexerDiagnostics()
+
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.depth += 1
+	case token.RBRACE:
+		if p.depth > 0 { // A stray } at the top level doesn't close anything
+			p.depth -= 1
+		}
+	}
 }
 
 // Simply parse together a list of statements by progressing through each token
@@ -336,19 +778,53 @@ func (p *Parser) ParseProgram() *ast.Program {
 		p.nextToken()
 	}
 
+	program.Comments = p.comments
 	return program
 }
 
 // So how do we parse statements?
+// If anything goes wrong along the way, we skip ahead to the next synchronisation point and hand back an ast.BadStatement covering what we skipped
 func (p *Parser) parseStatement() ast.Statement {
+	start := p.curToken
+	depth := p.depth
+	if p.curTokenIs(token.LBRACE) { // The depth already counts the brace this statement opens with
+		depth -= 1
+	}
+
+	var stmt ast.Statement
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		stmt = p.parseLetStatement()
 	case token.RETURN:
-		return p.parseReturnStatement()
+		stmt = p.parseReturnStatement()
+	case token.FUNCTION:
+		if p.peekTokenIs(token.IDENT) {
+			stmt = p.parseFunctionStatement()
+		} else {
+			stmt = p.parseExpressionStatement() // An anonymous function, e.g. one that is called straight away
+		}
+	case token.WHILE:
+		stmt = p.parseWhileStatement()
+	case token.FOR:
+		stmt = p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		stmt = p.parseLoopControlStatement()
 	default:
-		return p.parseExpressionStatement()
+		stmt = p.parseExpressionStatement()
 	}
+
+	if !p.panicking {
+		return stmt
+	}
+
+	p.synchronize(depth)
+
+	to := p.curToken.End
+	if p.depth < depth || p.curTokenIs(token.EOF) { // We stopped on a token that isn't ours
+		to = p.curToken.Start
+	}
+
+	return &ast.BadStatement{Token: start, To: to}
 }
 
 // So how do we parse expression statements?
@@ -369,8 +845,13 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.report(diag.Diagnostic{
+		Severity: diag.Error,
+		Code:     diag.NoPrefixParseFn,
+		Message:  fmt.Sprintf("no prefix parse function for %s found", t),
+		Span:     diag.TokenSpan(p.curToken),
+		Actual:   t,
+	})
 }
 
 // How do we parse a general expression
@@ -427,6 +908,125 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 
 }
 
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// for (init; condition; post) { body } - each of the three clauses is optional, but both semicolons are not
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	if !p.curTokenIs(token.SEMICOLON) {
+		stmt.Init = p.parseSimpleStatement()
+		// The let or expression statement will already have stepped onto its semicolon if there was one
+		if p.panicking || !p.curTokenIs(token.SEMICOLON) && !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	if !p.curTokenIs(token.SEMICOLON) {
+		stmt.Condition = p.parseExpression(LOWEST)
+		if !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	if !p.curTokenIs(token.RPAREN) {
+		// Just an expression, with nothing (not even a semicolon) between it and the )
+		post := &ast.ExpressionStatement{Token: p.curToken}
+		post.Expression = p.parseExpression(LOWEST)
+		stmt.Post = post
+		if p.panicking || !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// The statements allowed in the clauses of a for loop
+func (p *Parser) parseSimpleStatement() ast.Statement {
+	if p.curTokenIs(token.LET) {
+		return p.parseLetStatement()
+	}
+	return p.parseExpressionStatement()
+}
+
+// Parse the block of a loop - break and continue are fine in here
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth += 1
+	body := p.parseBlockStatement()
+	p.loopDepth -= 1
+
+	return body
+}
+
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	var stmt ast.Statement
+	if p.curTokenIs(token.BREAK) {
+		stmt = &ast.BreakStatement{Token: p.curToken}
+	} else {
+		stmt = &ast.ContinueStatement{Token: p.curToken}
+	}
+
+	if p.loopDepth == 0 {
+		p.report(diag.Diagnostic{
+			Severity: diag.Error,
+			Code:     diag.LoopControlOutsideLoop,
+			Message:  fmt.Sprintf("%s is only allowed inside the body of a loop", p.curToken.Literal),
+			Span:     diag.TokenSpan(p.curToken),
+			Actual:   p.curToken.Type,
+		})
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 // So how do we parse let statements?
 func (p *Parser) parseLetStatement() ast.Statement {
 	stmt := &ast.LetStatement{Token: p.curToken}
@@ -447,6 +1047,11 @@ func (p *Parser) parseLetStatement() ast.Statement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
+	// Let the function know what it is called, for printing and so the compiler can let it refer to itself
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -462,10 +1067,58 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
+	// Base 0 lets strconv work out 0x, 0o and 0b for us, and check the _ separators are only ever between digits
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+		p.report(diag.Diagnostic{
+			Severity: diag.Error,
+			Code:     diag.IntegerOverflow,
+			Message:  fmt.Sprintf("integer literal %s overflows int64, the largest integer is %d", p.curToken.Literal, int64(math.MaxInt64)),
+			Span:     diag.TokenSpan(p.curToken),
+			Actual:   token.INT,
+		})
+		return nil
+	}
+	if err != nil {
+		p.report(diag.Diagnostic{
+			Severity: diag.Error,
+			Code:     diag.InvalidInteger,
+			Message:  fmt.Sprintf("could not parse %q as integer", p.curToken.Literal),
+			Span:     diag.TokenSpan(p.curToken),
+			Actual:   token.INT,
+		})
+		return nil
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	if print_trace {
+		defer untrace(trace("parseFloatLiteral"))
+	}
+
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
+		switch p.curToken.Literal[len(p.curToken.Literal)-1] { // The lexer took an e that nothing useful came after
+		case 'e', 'E', '+', '-':
+			msg = fmt.Sprintf("float literal %s has no digits in its exponent", p.curToken.Literal)
+		}
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			msg = fmt.Sprintf("float literal %s is out of range", p.curToken.Literal)
+		}
+		p.report(diag.Diagnostic{
+			Severity: diag.Error,
+			Code:     diag.InvalidFloat,
+			Message:  msg,
+			Span:     diag.TokenSpan(p.curToken),
+			Actual:   token.FLOAT,
+		})
 		return nil
 	}
 
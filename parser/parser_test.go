@@ -1,10 +1,16 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"monkey/ast"
+	"monkey/diag"
 	"monkey/lexer"
+	"monkey/token"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestLetStatements(t *testing.T) {
@@ -329,6 +335,9 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 / 5", 5, "/", 5},
 		{"5 > 5", 5, ">", 5},
 		{"5 < 5", 5, "<", 5},
+		{"5 >= 5", 5, ">=", 5},
+		{"5 <= 5", 5, "<=", 5},
+		{"5 % 5", 5, "%", 5},
 		{"5 == 5", 5, "==", 5},
 		{"5 != 5", 5, "!=", 5},
 		{"true == true", true, "==", true},
@@ -376,6 +385,48 @@ func TestParsingInfixExpressions(t *testing.T) {
 	}
 }
 
+func TestLogicalExpression(t *testing.T) {
+	tests := []struct {
+		input      string
+		leftValue  interface{}
+		operator   string
+		rightValue interface{}
+	}{
+		{"true && false", true, "&&", false},
+		{"a || b", "a", "||", "b"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+
+		exp, ok := stmt.Expression.(*ast.LogicalExpression)
+		if !ok {
+			t.Fatalf("exp is not ast.LogicalExpression. got=%T", stmt.Expression)
+		}
+
+		if !testLiteralExpression(t, exp.Left, tt.leftValue) {
+			return
+		}
+
+		if exp.Operator != tt.operator {
+			t.Fatalf("exp.Operator is not '%s'. got=%s", tt.operator, exp.Operator)
+		}
+
+		if !testLiteralExpression(t, exp.Right, tt.rightValue) {
+			return
+		}
+	}
+}
+
 func TestOperatorPrecedenceParsing(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -433,6 +484,82 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"3 + 4 * 5 == 3 * 1 + 4 * 5",
 			"((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))",
 		},
+		{
+			"a + b % c",
+			"(a + (b % c))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a ? b : c",
+			"(a ? b : c)",
+		},
+		{
+			"a || b ? c + 1 : d * 2",
+			"((a || b) ? (c + 1) : (d * 2))",
+		},
+		{
+			"a ? b : c ? d : e",
+			"(a ? b : (c ? d : e))",
+		},
+		{
+			"a ? b ? c : d : e",
+			"(a ? (b ? c : d) : e)",
+		},
+		{
+			"x = a ? b : c",
+			"(x = (a ? b : c))",
+		},
+		{
+			"f(a ? b : c, d)",
+			"f((a ? b : c), d)",
+		},
+		{
+			"xs |> map(f) |> filter(g)",
+			"((xs |> map(f)) |> filter(g))",
+		},
+		{
+			"a + b |> f",
+			"((a + b) |> f)",
+		},
+		{
+			"a < b |> f",
+			"((a < b) |> f)",
+		},
+		{
+			"a == b |> f",
+			"((a == b) |> f)",
+		},
+		{
+			"xs |> f && ok",
+			"((xs |> f) && ok)",
+		},
+		{
+			"x = xs |> f(1) ? a : b",
+			"(x = ((xs |> f(1)) ? a : b))",
+		},
+		{
+			"xs |> fn(x) { x }",
+			"(xs |> fn(x)x)",
+		},
+		{
+			"a == b && c < d",
+			"((a == b) && (c < d))",
+		},
+		{
+			"!a && b",
+			"((!a) && b)",
+		},
 		{
 			"true",
 			"true",
@@ -690,6 +817,155 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestElseIfChain(t *testing.T) {
+	input := `if (x < 0) { a } else if (x == 0) { b } else if (x < 10) { c } else { d }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", 0) {
+		return
+	}
+
+	if len(exp.ElseIfs) != 2 {
+		t.Fatalf("exp.ElseIfs does not contain 2 branches. got=%d", len(exp.ElseIfs))
+	}
+
+	tests := []struct {
+		operator	string
+		right		int64
+		consequence	string
+	}{
+		{"==", 0, "b"},
+		{"<", 10, "c"},
+	}
+
+	for i, tt := range tests {
+		ei := exp.ElseIfs[i]
+		if !testInfixExpression(t, ei.Condition, "x", tt.operator, tt.right) {
+			return
+		}
+		consequence := ei.Consequence.Statements[0].(*ast.ExpressionStatement)
+		if !testIdentifier(t, consequence.Expression, tt.consequence) {
+			return
+		}
+	}
+
+	alternative := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !testIdentifier(t, alternative.Expression, "d") {
+		return
+	}
+
+	expected := "if(x < 0) aelse if(x == 0) belse if(x < 10) celse d"
+	if exp.String() != expected {
+		t.Errorf("exp.String() wrong. want %q, got=%q", expected, exp.String())
+	}
+
+	if exp.End().Offset != len(input) {
+		t.Errorf("exp.End() wrong. want offset %d, got=%d", len(input), exp.End().Offset)
+	}
+}
+
+func TestElseIfWithoutElse(t *testing.T) {
+	l := lexer.New(`if (a) { 1 } else if (b) { 2 }`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	exp := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if len(exp.ElseIfs) != 1 {
+		t.Fatalf("exp.ElseIfs does not contain 1 branch. got=%d", len(exp.ElseIfs))
+	}
+	if exp.Alternative != nil {
+		t.Errorf("exp.Alternative was not nil. got=%+v", exp.Alternative)
+	}
+}
+
+func TestConditionalExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a ? b c", "1:7: expected next token to be :, got IDENT instead"},
+		// The alternative binds tighter than assignment, so this assigns to the whole conditional
+		{"a ? x = 1 : y = 2", "1:1: cannot assign to (a ? (x = 1) : y), only to a name or an index expression"},
+		{"if (a) { 1 } else if { 2 }", "1:22: expected next token to be (, got { instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected %q first, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestPipeExpression(t *testing.T) {
+	input := "xs |> map(f, 2)"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.PipeExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.PipeExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Left, "xs") {
+		return
+	}
+
+	right, ok := exp.Right.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("exp.Right is not ast.CallExpression. got=%T", exp.Right)
+	}
+	if len(right.Arguments) != 2 {
+		t.Fatalf("the call on the right was changed. want 2 arguments, got=%d", len(right.Arguments))
+	}
+
+	if exp.Pos().Offset != 0 || exp.End().Offset != len(input) {
+		t.Errorf("exp span wrong. got %d..%d", exp.Pos().Offset, exp.End().Offset)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"xs |> map(f, 2)", "map(xs, f, 2)"},
+		{"xs |> f", "f(xs)"},
+		{"xs |> f()", "f(xs)"},
+		{"xs |> make(1)(2)", "make(1)(xs, 2)"},
+		{"xs |> fn(x) { x }", "fn(x)x(xs)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		pipe := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.PipeExpression)
+		if pipe.Call().String() != tt.expected {
+			t.Errorf("Call() wrong for %q. want %q, got=%q", tt.input, tt.expected, pipe.Call().String())
+		}
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -720,8 +996,8 @@ func TestFunctionLiteralParsing(t *testing.T) {
 			len(function.Parameters))	
 	}
 
-	testLiteralExpression(t, function.Parameters[0], "x")
-	testLiteralExpression(t, function.Parameters[1], "y")
+	testLiteralExpression(t, function.Parameters[0].Name, "x")
+	testLiteralExpression(t, function.Parameters[1].Name, "y")
 
 	if len(function.Body.Statements) != 1 {
 		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n",
@@ -762,7 +1038,81 @@ func TestFunctionParameterParsing(t *testing.T) {
 		}
 
 		for i, ident := range tt.expectedParams {
-			testLiteralExpression(t, function.Parameters[i], ident)
+			testLiteralExpression(t, function.Parameters[i].Name, ident)
+		}
+	}
+}
+
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{"fn(a, b = 2) {}", []string{"a", "b = 2"}},
+		{"fn(a, b = a * 2, ...rest) {}", []string{"a", "b = (a * 2)", "...rest"}},
+		{"fn(...args) {}", []string{"...args"}},
+		{"fn(a, b,) {}", []string{"a", "b"}},
+		{"fn(a = 1, ...rest,) {}", []string{"a = 1", "...rest"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("length parameters wrong for %q. want %d, got=%d",
+				tt.input, len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, expected := range tt.expectedParams {
+			if function.Parameters[i].String() != expected {
+				t.Errorf("parameter %d of %q wrong. want %q, got=%q",
+					i, tt.input, expected, function.Parameters[i].String())
+			}
+		}
+
+		last := function.Parameters[len(function.Parameters)-1]
+		if last.Rest != strings.HasPrefix(tt.expectedParams[len(tt.expectedParams)-1], "...") {
+			t.Errorf("last parameter of %q has Rest=%t", tt.input, last.Rest)
+		}
+	}
+}
+
+func TestInvalidParameters(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedCode    diag.Code
+		expectedMessage string
+	}{
+		{"fn(a, a) {}", diag.DuplicateParameter, "1:7: duplicate parameter a"},
+		{"fn(a = 1, b) {}", diag.InvalidParameter, "1:11: required parameter b can't follow a, which has a default value"},
+		{"fn(...rest, a) {}", diag.InvalidParameter, "1:13: ...rest must be the last parameter"},
+		{"fn(...a, ...b) {}", diag.InvalidParameter, "1:10: ...a must be the last parameter"},
+		{"fn(...rest = 1) {}", diag.InvalidParameter, "1:4: ...rest can't have a default value, it is an empty array when no arguments are left over"},
+		{"fn(1) {}", diag.UnexpectedToken, "1:4: expected a parameter name, got INT instead"},
+		{"fn(a, , b) {}", diag.UnexpectedToken, "1:7: expected a parameter name, got , instead"},
+		{"fn(,) {}", diag.UnexpectedToken, "1:4: expected a parameter name, got , instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) == 0 {
+			t.Fatalf("expected a diagnostic for %q, got none", tt.input)
+		}
+		if diagnostics[0].Code != tt.expectedCode {
+			t.Errorf("diagnostics[0].Code for %q not %q. got=%q", tt.input, tt.expectedCode, diagnostics[0].Code)
+		}
+		if diagnostics[0].String() != tt.expectedMessage {
+			t.Errorf("diagnostics[0] wrong. want %q, got=%q", tt.expectedMessage, diagnostics[0].String())
 		}
 	}
 }
@@ -848,4 +1198,1027 @@ func checkParserErrors(t *testing.T, p *Parser) {
 		t.Errorf("parser error: %q", msg)
 	}
 	t.FailNow() // Stop the current test if we had any errors
-}
\ No newline at end of file
+}
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x 5;", "1:7: expected next token to be =, got INT instead"},
+		{"let x = 5;\nlet = 10;", "2:5: expected next token to be IDENT, got = instead"},
+		{"add(1, 2;", "1:9: expected next token to be ), got ; instead"},
+		{"\n\n  +5", "3:3: no prefix parse function for + found"},
+		{"let f = fn(x) {\n  x", "2:4: expected next token to be }, got EOF instead"}, // A block that never gets closed
+		{"while (true) { if (x) { 1 }", "1:28: expected next token to be }, got EOF instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q",
+				tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestNodeSpans(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStart string
+		expectedEnd   string
+	}{
+		{"a + b * c", "1:1", "1:10"},
+		{"add(1, 2)", "1:1", "1:10"},
+		{"let x = -y;", "1:1", "1:11"},
+		{"if (x) {\n  y\n}", "1:1", "3:2"},
+		{"fn(x) { x }", "1:1", "1:12"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0]
+		if stmt.Pos().String() != tt.expectedStart {
+			t.Errorf("wrong start for %q. expected=%s, got=%s",
+				tt.input, tt.expectedStart, stmt.Pos())
+		}
+		if stmt.End().String() != tt.expectedEnd {
+			t.Errorf("wrong end for %q. expected=%s, got=%s",
+				tt.input, tt.expectedEnd, stmt.End())
+		}
+	}
+}
+
+func TestIntegerLiteralBases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xff", 255},
+		{"0XFF", 255},
+		{"0o17", 15},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0x_7fff_ffff", 0x7fffffff},
+		{"9223372036854775807", 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %d. got=%d", tt.expected, literal.Value)
+		}
+		// The spelling from the source survives, rather than being normalised to decimal
+		if literal.String() != tt.input {
+			t.Errorf("literal.String() not %q. got=%q", tt.input, literal.String())
+		}
+	}
+}
+
+func TestInvalidIntegerLiteral(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedCode    diag.Code
+		expectedMessage string
+	}{
+		{"9223372036854775808", diag.IntegerOverflow,
+			"1:1: integer literal 9223372036854775808 overflows int64, the largest integer is 9223372036854775807"},
+		{"0xffff_ffff_ffff_ffff", diag.IntegerOverflow,
+			"1:1: integer literal 0xffff_ffff_ffff_ffff overflows int64, the largest integer is 9223372036854775807"},
+		{"0b102", diag.InvalidInteger, `1:1: could not parse "0b102" as integer`},
+		{"1__000", diag.InvalidInteger, `1:1: could not parse "1__000" as integer`},
+		{"100_", diag.InvalidInteger, `1:1: could not parse "100_" as integer`},
+		{"0x", diag.InvalidInteger, `1:1: could not parse "0x" as integer`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) != 1 {
+			t.Fatalf("wrong number of diagnostics for %q. want 1, got=%d (%v)",
+				tt.input, len(diagnostics), diagnostics)
+		}
+		if diagnostics[0].Code != tt.expectedCode {
+			t.Errorf("diagnostics[0].Code not %q. got=%q", tt.expectedCode, diagnostics[0].Code)
+		}
+		if diagnostics[0].String() != tt.expectedMessage {
+			t.Errorf("diagnostics[0] wrong. want %q, got=%q", tt.expectedMessage, diagnostics[0].String())
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{".5;", 0.5},
+		{"1e-9;", 1e-9},
+		{"2.5E3;", 2500},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+		if literal.String() != tt.input[:len(tt.input)-1] {
+			t.Errorf("literal.String() not %q. got=%q", tt.input[:len(tt.input)-1], literal.String())
+		}
+	}
+}
+
+func TestInvalidFloatLiteral(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"1.2.3", `1:1: could not parse "1.2.3" as float`},
+		{"1e999", "1:1: float literal 1e999 is out of range"},
+		{"let x = 1e;", "1:9: float literal 1e has no digits in its exponent"},
+		{"1E+", "1:1: float literal 1E+ has no digits in its exponent"},
+		{"2.5e-", "1:1: float literal 2.5e- has no digits in its exponent"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) != 1 {
+			t.Fatalf("wrong number of diagnostics for %q. want 1, got=%d (%v)",
+				tt.input, len(diagnostics), diagnostics)
+		}
+		if diagnostics[0].Code != diag.InvalidFloat {
+			t.Errorf("diagnostics[0].Code not %q. got=%q", diag.InvalidFloat, diagnostics[0].Code)
+		}
+		if diagnostics[0].String() != tt.expectedMessage {
+			t.Errorf("diagnostics[0] wrong. want %q, got=%q", tt.expectedMessage, diagnostics[0].String())
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	input := "add(1, 2;"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. want 1, got=%d", len(diagnostics))
+	}
+
+	d := diagnostics[0]
+	if d.Severity != diag.Error {
+		t.Errorf("d.Severity not %s. got=%s", diag.Error, d.Severity)
+	}
+	if d.Code != diag.UnexpectedToken {
+		t.Errorf("d.Code not %q. got=%q", diag.UnexpectedToken, d.Code)
+	}
+	if d.Span.Start.Offset != 8 || d.Span.End.Offset != 9 {
+		t.Errorf("d.Span wrong. want offsets 8-9, got=%d-%d",
+			d.Span.Start.Offset, d.Span.End.Offset)
+	}
+	if len(d.Expected) != 1 || d.Expected[0] != token.RPAREN {
+		t.Errorf("d.Expected wrong. want [%s], got=%v", token.RPAREN, d.Expected)
+	}
+	if d.Actual != token.SEMICOLON {
+		t.Errorf("d.Actual not %s. got=%s", token.SEMICOLON, d.Actual)
+	}
+	if len(d.Fixes) != 1 || d.Fixes[0].NewText != ")" {
+		t.Fatalf("d.Fixes wrong. got=%+v", d.Fixes)
+	}
+	if d.Fixes[0].Span.Start != d.Fixes[0].Span.End {
+		t.Errorf("fix should be an insertion. got span=%+v", d.Fixes[0].Span)
+	}
+
+	// Errors() is just the diagnostics formatted as strings
+	if p.Errors()[0] != d.String() {
+		t.Errorf("p.Errors()[0] wrong. want %q, got=%q", d.String(), p.Errors()[0])
+	}
+}
+
+func TestNoPrefixParseFnDiagnostic(t *testing.T) {
+	l := lexer.New("let x = ;")
+	p := New(l)
+	p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. want 1, got=%d", len(diagnostics))
+	}
+	if diagnostics[0].Code != diag.NoPrefixParseFn {
+		t.Errorf("diagnostics[0].Code not %q. got=%q", diag.NoPrefixParseFn, diagnostics[0].Code)
+	}
+	if diagnostics[0].Actual != token.SEMICOLON {
+		t.Errorf("diagnostics[0].Actual not %s. got=%s", token.SEMICOLON, diagnostics[0].Actual)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors int
+		expected       []string // String() of each statement we should get back
+	}{
+		{
+			"let x 5 * 3 + 2; let y = 1;",
+			1,
+			[]string{"<bad statement>", "let y = 1;"},
+		},
+		{
+			"let = 5\nlet y = 1;\nreturn y;",
+			1,
+			[]string{"<bad statement>", "let y = 1;", "return y;"},
+		},
+		{
+			"if (x { y } let z = 1;",
+			1,
+			[]string{"<bad statement>", "let z = 1;"},
+		},
+		{
+			"let f = fn(x) { let = 1; x }; f(2);",
+			1,
+			[]string{"let f = fn<f>(x)<bad statement>x;", "f(2)"},
+		},
+		{
+			"let f = fn(x) { x + }; let g = 1;",
+			1,
+			[]string{"let f = fn<f>(x)<bad statement>;", "let g = 1;"},
+		},
+		{
+			"let a = ; let b = ; let c = 3;",
+			2,
+			[]string{"<bad statement>", "<bad statement>", "let c = 3;"},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		if len(p.Errors()) != tt.expectedErrors {
+			t.Errorf("wrong number of errors for %q. want %d, got=%d (%v)",
+				tt.input, tt.expectedErrors, len(p.Errors()), p.Errors())
+		}
+
+		if len(program.Statements) != len(tt.expected) {
+			t.Fatalf("wrong number of statements for %q. want %d, got=%d (%q)",
+				tt.input, len(tt.expected), len(program.Statements), program.String())
+		}
+
+		for i, expected := range tt.expected {
+			if program.Statements[i].String() != expected {
+				t.Errorf("statement %d of %q wrong. want %q, got=%q",
+					i, tt.input, expected, program.Statements[i].String())
+			}
+		}
+	}
+}
+
+func TestBadStatementSpan(t *testing.T) {
+	input := "let x 5;\nlet y = 1;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	bad, ok := program.Statements[0].(*ast.BadStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.BadStatement. got=%T", program.Statements[0])
+	}
+
+	if bad.Pos().String() != "1:1" || bad.End().String() != "1:9" {
+		t.Errorf("bad statement span wrong. want 1:1-1:9, got=%s-%s", bad.Pos(), bad.End())
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello world";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
+func TestStringLiteralRoundTrip(t *testing.T) {
+	tests := []string{
+		`"plain"`,
+		`"tab\there"`,
+		`"line\nbreak"`,
+		`"say \"hi\" \\ bye"`,
+		`"bell\u{7}"`,
+		`"\u{48}i"`,
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		first := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.StringLiteral)
+
+		// Whatever String() gives back has to lex to the same value again
+		l = lexer.New(first.String())
+		p = New(l)
+		program = p.ParseProgram()
+		checkParserErrors(t, p)
+
+		second := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.StringLiteral)
+		if first.Value != second.Value {
+			t.Errorf("round trip of %s changed the value. want %q, got=%q",
+				input, first.Value, second.Value)
+		}
+	}
+}
+
+func TestLexerErrorsReachParser(t *testing.T) {
+	l := lexer.New(`let s = "never closed;`)
+	p := New(l)
+	p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. want 1, got=%d (%v)", len(diagnostics), p.Errors())
+	}
+	if diagnostics[0].Code != diag.UnterminatedString {
+		t.Errorf("diagnostics[0].Code not %q. got=%q", diag.UnterminatedString, diagnostics[0].Code)
+	}
+}
+
+func TestParseFromReader(t *testing.T) {
+	l := lexer.NewReader(strings.NewReader("let x = 5; fn add(a, b) { a + b } add(x, 1)"))
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	// A read error shows up as its own diagnostic, ahead of whatever the truncated input trips over
+	l = lexer.NewReader(io.MultiReader(strings.NewReader("let x = "), iotest.ErrReader(errors.New("broken pipe"))))
+	p = New(l)
+	p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) == 0 || diagnostics[0].Code != diag.ReadError {
+		t.Fatalf("expected a %q diagnostic first. got=%v", diag.ReadError, p.Errors())
+	}
+	if diagnostics[0].String() != "1:9: error reading input: broken pipe" {
+		t.Errorf("diagnostics[0] wrong. got=%q", diagnostics[0].String())
+	}
+}
+
+func TestCommentsAreIgnored(t *testing.T) {
+	input := `// add things up
+let add = fn(x, y) { /* no checks */ x + y }; // done
+add(1, /* two */ 2)`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := "let add = fn<add>(x, y)(x + y);add(1, 2)"
+	if program.String() != expected {
+		t.Errorf("program.String() wrong. expected=%q, got=%q", expected, program.String())
+	}
+	// They don't make it into the tree, but the program keeps them all for tools like the formatter
+	comments := []string{"// add things up", "/* no checks */", "// done", "/* two */"}
+	if len(program.Comments) != len(comments) {
+		t.Fatalf("program.Comments has %d comments, want %d", len(program.Comments), len(comments))
+	}
+	for i, text := range comments {
+		if program.Comments[i].Text != text {
+			t.Errorf("program.Comments[%d] wrong. want %q, got=%q", i, text, program.Comments[i].Text)
+		}
+	}
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+
+	if array.End().String() != "1:18" {
+		t.Errorf("array.End() wrong. want 1:18, got=%s", array.End())
+	}
+}
+
+func TestParsingEmptyArrayLiterals(t *testing.T) {
+	input := "[]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 0 {
+		t.Errorf("len(array.Elements) not 0. got=%d", len(array.Elements))
+	}
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+}
+
+func TestIndexPrecedenceParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
+		{
+			"fns[0](1)",
+			"(fns[0])(1)",
+		},
+		{
+			"-a[0]",
+			"(-(a[0]))",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestParsingHashLiteralsStringKeys(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
+	}
+
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
+			continue
+		}
+
+		if literal.Value != expected[i].key {
+			t.Errorf("key %d wrong. want %q, got=%q", i, expected[i].key, literal.Value)
+		}
+
+		testIntegerLiteral(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestParsingEmptyHashLiteral(t *testing.T) {
+	input := "{}"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+}
+
+func TestParsingHashLiteralsWithExpressions(t *testing.T) {
+	input := `{"one": 0 + 1, true: 10 - 8, 1 + 2: 15 / 5}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	testInfixExpression(t, hash.Pairs[0].Value, 0, "+", 1)
+	testBooleanLiteral(t, hash.Pairs[1].Key, true)
+	testInfixExpression(t, hash.Pairs[1].Value, 10, "-", 8)
+	testInfixExpression(t, hash.Pairs[2].Key, 1, "+", 2)
+	testInfixExpression(t, hash.Pairs[2].Value, 15, "/", 5)
+}
+
+func TestHashLiteralsVersusBlocks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// A block after 'if' or a parameter list, a hash wherever an expression starts
+		{`if (x) { {"a": 1} }`, `ifx {"a": 1}`},
+		{`fn() { {} }`, `fn(){}`},
+		{`let h = {"k": {"nested": true}};`, `let h = {"k": {"nested": true}};`},
+		{`f({1: 2})[1]`, `(f({1: 2})[1])`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestHashLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"a" 1}`, "1:6: expected next token to be :, got INT instead"},
+		{`{"a": 1 "b": 2}`, "1:9: expected next token to be ,, got STRING instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected=[%q], got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { x; break; continue }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T", program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("body is not 3 statements. got=%d", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("body.Statements[1] is not ast.BreakStatement. got=%T", stmt.Body.Statements[1])
+	}
+	if _, ok := stmt.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("body.Statements[2] is not ast.ContinueStatement. got=%T", stmt.Body.Statements[2])
+	}
+
+	if stmt.End().Offset != len(input) {
+		t.Errorf("stmt.End() wrong. want offset %d, got=%d", len(input), stmt.End().Offset)
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input        string
+		hasInit      bool
+		hasCondition bool
+		hasPost      bool
+		expected     string
+	}{
+		{"for (let i = 0; i < 10; i + 1) { i }", true, true, true,
+			"for (let i = 0; (i < 10); (i + 1)) i"},
+		{"for (;;) { break; }", false, false, false, "for (; ; ) break;"},
+		{"for (i; i < 3;) { }", true, true, false, "for (i; (i < 3); ) "},
+		{"for (; ; f(i)) { continue }", false, false, true, "for (; ; f(i)) continue;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement for %q. got=%d",
+				tt.input, len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T", program.Statements[0])
+		}
+
+		if (stmt.Init != nil) != tt.hasInit {
+			t.Errorf("stmt.Init wrong for %q. got=%v", tt.input, stmt.Init)
+		}
+		if (stmt.Condition != nil) != tt.hasCondition {
+			t.Errorf("stmt.Condition wrong for %q. got=%v", tt.input, stmt.Condition)
+		}
+		if (stmt.Post != nil) != tt.hasPost {
+			t.Errorf("stmt.Post wrong for %q. got=%v", tt.input, stmt.Post)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want %q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+// The post clause is a bare expression, closed by the )
+func TestForStatementErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"for (let i = 0; i < 3; i + 1;) { }", "1:29: expected next token to be ), got ; instead"},
+		{"for (;; let i = 1) { }", "1:9: no prefix parse function for LET found"},
+		{"for (;; i + 1 { }", "1:15: expected next token to be ), got { instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expectedMessage {
+			t.Errorf("wrong error for %q. want %q, got=%q", tt.input, tt.expectedMessage, errors[0])
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"break;", "1:1: break is only allowed inside the body of a loop"},
+		{"if (true) { continue; }", "1:13: continue is only allowed inside the body of a loop"},
+		// A function body starts a fresh context, even when the function is written inside a loop
+		{"while (true) { fn() { break; } }", "1:23: break is only allowed inside the body of a loop"},
+		// Default values too - they run when the function is called, not in the loop it was written in
+		{"while (true) { let f = fn(a = if (true) { break } else { 1 }) { a }; f(); }; 7", "1:43: break is only allowed inside the body of a loop"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) == 0 {
+			t.Fatalf("expected a diagnostic for %q, got none", tt.input)
+		}
+		if diagnostics[0].Code != diag.LoopControlOutsideLoop {
+			t.Errorf("diagnostics[0].Code not %q. got=%q", diag.LoopControlOutsideLoop, diagnostics[0].Code)
+		}
+		if diagnostics[0].String() != tt.expectedMessage {
+			t.Errorf("diagnostics[0] wrong. want %q, got=%q", tt.expectedMessage, diagnostics[0].String())
+		}
+	}
+}
+
+func TestLoopControlInsideNestedLoops(t *testing.T) {
+	input := `
+while (a) {
+	if (b) { break; }
+	for (;;) { continue; }
+	let f = fn() { while (c) { break; } };
+	continue;
+}`
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+	checkParserErrors(t, p)
+}
+
+func TestAssignExpression(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedOperator string
+		expected         string
+	}{
+		{"x = 5", "=", "(x = 5)"},
+		{"x = x + 1", "=", "(x = (x + 1))"},
+		{"x += 1", "+=", "(x += 1)"},
+		{"x -= y * 2", "-=", "(x -= (y * 2))"},
+		{"x *= 3", "*=", "(x *= 3)"},
+		{"x /= 4", "/=", "(x /= 4)"},
+		{"arr[i] = v", "=", "((arr[i]) = v)"},
+		{`h["k"] = v`, "=", `((h["k"]) = v)`},
+		{"x = y = 3", "=", "(x = (y = 3))"},
+		{"x = a || b", "=", "(x = (a || b))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+
+		exp, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("exp is not ast.AssignExpression. got=%T", stmt.Expression)
+		}
+		if exp.Operator != tt.expectedOperator {
+			t.Errorf("exp.Operator is not %q. got=%q", tt.expectedOperator, exp.Operator)
+		}
+		if exp.String() != tt.expected {
+			t.Errorf("exp.String() wrong. want %q, got=%q", tt.expected, exp.String())
+		}
+	}
+}
+
+func TestInvalidAssignmentTarget(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedEnd     int
+	}{
+		{"1 = 2", "1:1: cannot assign to 1, only to a name or an index expression", 1},
+		{"f() = 3", "1:1: cannot assign to f(), only to a name or an index expression", 3},
+		{"a + b += 1", "1:1: cannot assign to (a + b), only to a name or an index expression", 5},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) != 1 {
+			t.Fatalf("wrong number of diagnostics for %q. want 1, got=%d (%v)",
+				tt.input, len(diagnostics), diagnostics)
+		}
+		if diagnostics[0].Code != diag.InvalidAssignmentTarget {
+			t.Errorf("diagnostics[0].Code not %q. got=%q", diag.InvalidAssignmentTarget, diagnostics[0].Code)
+		}
+		if diagnostics[0].String() != tt.expectedMessage {
+			t.Errorf("diagnostics[0] wrong. want %q, got=%q", tt.expectedMessage, diagnostics[0].String())
+		}
+		if diagnostics[0].Span.End.Offset != tt.expectedEnd {
+			t.Errorf("diagnostics[0].Span ends at %d, want %d", diagnostics[0].Span.End.Offset, tt.expectedEnd)
+		}
+	}
+}
+
+func TestFunctionStatement(t *testing.T) {
+	input := `fn add(a, b) { a + b }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.FunctionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.FunctionStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.Name.Value != "add" {
+		t.Errorf("stmt.Name.Value not 'add'. got=%q", stmt.Name.Value)
+	}
+	if stmt.Function.Name != "add" {
+		t.Errorf("stmt.Function.Name not 'add'. got=%q", stmt.Function.Name)
+	}
+	if len(stmt.Function.Parameters) != 2 {
+		t.Fatalf("function has wrong number of parameters. got=%d", len(stmt.Function.Parameters))
+	}
+	testLiteralExpression(t, stmt.Function.Parameters[0].Name, "a")
+	testLiteralExpression(t, stmt.Function.Parameters[1].Name, "b")
+
+	if stmt.String() != "fn add(a, b) (a + b)" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+	if stmt.End().Offset != len(input) {
+		t.Errorf("stmt.End() wrong. want offset %d, got=%d", len(input), stmt.End().Offset)
+	}
+}
+
+func TestFunctionLiteralName(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedName string
+	}{
+		{"let myFunction = fn() { };", "myFunction"},
+		{"fn myFunction() { }", "myFunction"},
+		{"fn() { }", ""},
+		{"let f = g(fn() { });", ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var function *ast.FunctionLiteral
+		switch stmt := program.Statements[0].(type) {
+		case *ast.LetStatement:
+			function, _ = stmt.Value.(*ast.FunctionLiteral)
+			if call, ok := stmt.Value.(*ast.CallExpression); ok {
+				function, _ = call.Arguments[0].(*ast.FunctionLiteral)
+			}
+		case *ast.FunctionStatement:
+			function = stmt.Function
+		case *ast.ExpressionStatement:
+			function, _ = stmt.Expression.(*ast.FunctionLiteral)
+		}
+		if function == nil {
+			t.Fatalf("no function literal found in %q", tt.input)
+		}
+
+		if function.Name != tt.expectedName {
+			t.Errorf("function literal name wrong for %q. want %q, got=%q", tt.input, tt.expectedName, function.Name)
+		}
+	}
+}
+
+func TestAnonymousFunctionStatement(t *testing.T) {
+	// A statement starting with fn but no name is still an expression statement
+	l := lexer.New("fn(x) { x }(5);")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	if _, ok := stmt.Expression.(*ast.CallExpression); !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+}
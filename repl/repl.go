@@ -6,8 +6,17 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"monkey/ast"
+	"monkey/astdot"
+	"monkey/compiler"
+	"monkey/diag"
+	"monkey/evaluator"
 	"monkey/lexer"
+	"monkey/object"
 	"monkey/parser"
+	"monkey/token"
+	"monkey/vm"
+	"strings"
 )
 
 const MONKEY_FACE = `
@@ -25,12 +34,32 @@ const MONKEY_FACE = `
 `
 
 const PROMPT = ">> "
+const CONTINUATION_PROMPT = ".. " // Shown while we wait for the rest of an input that isn't finished yet
 
-func Start(in io.Reader, out io.Writer) { // Read until you encounter a new line, take the just read line and pass it to our lexer
+// Type this in front of some code to see the tree the parser builds for it, as a Graphviz DOT graph, instead of running it
+const DOT_COMMAND = ":dot "
+
+// The two ways we can run a program
+const (
+	ENGINE_VM   = "vm" // Compile to bytecode and run it on the virtual machine
+	ENGINE_EVAL = "eval" // Walk the AST with the evaluator
+)
+
+func Start(in io.Reader, out io.Writer) {
+	StartWithEngine(in, out, ENGINE_VM)
+}
+
+func StartWithEngine(in io.Reader, out io.Writer, engine string) { // Read until you encounter a new line, take the just read line and pass it to our lexer
 	scanner := bufio.NewScanner(in) // Like a BufferedReader in Java
+	run := newRunner(engine, out) // Lives across lines, so a let on one line can be used on the next
+	var lines []string // What we have of an input that isn't finished yet, like the first line of a function
 
 	for {
-		fmt.Print(PROMPT)
+		if len(lines) == 0 {
+			fmt.Fprint(out, PROMPT)
+		} else {
+			fmt.Fprint(out, CONTINUATION_PROMPT)
+		}
 		scanned := scanner.Scan()
 		if !scanned {
 			return
@@ -38,18 +67,96 @@ func Start(in io.Reader, out io.Writer) { // Read until you encounter a new line
 
 		// Read until you encounter a new line
 		line := scanner.Text()
-		// Take the just read line and pass it to our lexer
-		l := lexer.New(line)
+
+		// An empty line while we wait for more gives up on the input, so a stray { or " can't keep us waiting forever
+		giveUp := len(lines) > 0 && strings.TrimSpace(line) == ""
+		if !giveUp {
+			lines = append(lines, line)
+		}
+		input := strings.Join(lines, "\n")
+
+		dot := strings.HasPrefix(input, DOT_COMMAND)
+		if dot {
+			input = strings.TrimPrefix(input, DOT_COMMAND)
+		}
+
+		// Take everything read so far and pass it to our lexer
+		l := lexer.New(input)
 		p := parser.New(l)
 
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
+			if !giveUp && incomplete(p.Diagnostics()) {
+				continue // Go get the next line
+			}
+			lines = nil
 			printParseErrors(out, p.Errors())
 			continue
 		}
+		lines = nil
+
+		if dot {
+			io.WriteString(out, astdot.Graph(program))
+			continue
+		}
+
+		run(program)
+	}
+}
+
+// Did parsing fail only because the input stopped too soon? That is the case when the first error is about running into the end of it -
+// an unclosed brace or paren, an operator with nothing after it, a string or comment that's still open
+// Anything that went wrong before that won't get better with more lines
+func incomplete(diagnostics []diag.Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == diag.Error {
+			return d.Actual == token.EOF
+		}
+	}
+	return false
+}
+
+// Set up whatever state the engine keeps between lines, and hand back a function that runs one line's program and prints the result
+func newRunner(engine string, out io.Writer) func(*ast.Program) {
+	if engine == ENGINE_EVAL {
+		env := object.NewEnvironment()
+
+		return func(program *ast.Program) {
+			evaluated := evaluator.Eval(program, env)
+			if evaluated != nil { // let statements don't produce anything worth printing
+				io.WriteString(out, evaluated.Inspect())
+				io.WriteString(out, "\n")
+			}
+		}
+	}
+
+	constants := []object.Object{}
+	globals := make([]object.Object, vm.GlobalsSize)
+	symbolTable := compiler.NewSymbolTable()
 
-		io.WriteString(out, program.String())
-		io.WriteString(out, "\n")
+	return func(program *ast.Program) {
+		comp := compiler.NewWithState(symbolTable, constants)
+		err := comp.Compile(program)
+		if err != nil {
+			fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
+			return
+		}
+
+		code := comp.Bytecode()
+		constants = code.Constants
+
+		machine := vm.NewWithGlobalsStore(code, globals)
+		err = machine.Run()
+		if err != nil {
+			fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", err)
+			return
+		}
+
+		lastPopped := machine.LastPoppedStackElem()
+		if lastPopped != nil {
+			io.WriteString(out, lastPopped.Inspect())
+			io.WriteString(out, "\n")
+		}
 	}
 }
 
@@ -0,0 +1,105 @@
+package repl
+
+import (
+	"bytes"
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let f = fn(x) {", true},
+		{"while (x < 3) { x += 1;", true},
+		{"if (x) { 1 } else", true},
+		{"add(1,", true},
+		{"[1, 2", true},
+		{`{"a": 1`, true},
+		{"1 +", true},
+		{"let x =", true},
+		{"a ? b :", true},
+		{"xs |>", true},
+		{`"a string that goes on`, true},
+		{"/* a comment that goes on", true},
+
+		{"let x = 1;", false},
+		{"1 + * 2", false}, // Broken already, more input won't fix it
+		{"let = fn() {", false},
+		{"}", false},
+		{"let x = 1 )", false},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if incomplete(p.Diagnostics()) != tt.expected {
+			t.Errorf("incomplete(%q) wrong. want %t, diagnostics: %v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+// Feed a session to the REPL and hand back everything it wrote, prompts included
+func session(input string, engine string) string {
+	var out bytes.Buffer
+	StartWithEngine(strings.NewReader(input), &out, engine)
+	return out.String()
+}
+
+func TestMultiLineInput(t *testing.T) {
+	input := `let f = fn(x) {
+	let y = x * 2;
+	y + 1
+}
+f(3)
+"two
+lines"
+1 +
+2
+`
+	expected := ">> .. .. .. >> 7\n>> .. two\nlines\n>> .. 3\n>> "
+
+	for _, engine := range []string{ENGINE_VM, ENGINE_EVAL} {
+		got := session(input, engine)
+		if got != expected {
+			t.Errorf("wrong output with the %s engine.\nwant %q\ngot= %q", engine, expected, got)
+		}
+	}
+}
+
+// A declaration is null, and both engines show it the same way
+func TestDeclarationValue(t *testing.T) {
+	expected := ">> null\n>> 2\n>> "
+
+	for _, engine := range []string{ENGINE_VM, ENGINE_EVAL} {
+		got := session("fn f() { 2 }\nf()\n", engine)
+		if got != expected {
+			t.Errorf("wrong output with the %s engine.\nwant %q\ngot= %q", engine, expected, got)
+		}
+	}
+}
+
+func TestMultiLineErrors(t *testing.T) {
+	// An error that more lines can't fix is reported straight away
+	got := session("1 + * 2\n3\n", ENGINE_VM)
+	if !strings.HasPrefix(got, ">> "+MONKEY_FACE) || !strings.HasSuffix(got, "1:5: no prefix parse function for * found\n>> 3\n>> ") {
+		t.Errorf("wrong output for a broken line: %q", got)
+	}
+
+	// An empty line gives up on an unfinished input and shows what is wrong with it
+	got = session("let f = fn() {\n\n5\n", ENGINE_VM)
+	if !strings.HasPrefix(got, ">> .. "+MONKEY_FACE) || !strings.HasSuffix(got, "1:15: expected next token to be }, got EOF instead\n>> 5\n>> ") {
+		t.Errorf("wrong output after giving up: %q", got)
+	}
+}
+
+func TestDotCommand(t *testing.T) {
+	got := session(":dot [1,\n2]\n", ENGINE_VM)
+	if !strings.HasPrefix(got, ">> .. digraph AST {\n") || !strings.Contains(got, `[label="Elements[1]"]`) {
+		t.Errorf("wrong output for :dot over two lines: %q", got)
+	}
+}
@@ -1,10 +1,50 @@
 package token
 
+import "fmt"
+
 type TokenType string // Making this a string makes it easier to debug
 
 type Token struct {
 	Type TokenType // To distinguish between "integers" and "right bracket" for example
 	Literal string // The literal value of the token - so is the "integer" a 5 or a 10?
+	Start Position // Where the first character of the token sits in the source
+	End Position // Where the character just past the token sits in the source - so End.Offset - Start.Offset is the token's length in bytes
+	Leading []Comment // Trivia - the comments between the previous token and this one, in source order
+}
+
+// A comment the lexer skipped over - the parser never sees these, but they ride along on the next token so tools can put them back
+type Comment struct {
+	Text string // The whole comment, including the // or /* */ markers
+	Start Position
+	End Position
+}
+
+// Is this a /* */ comment rather than a // one?
+func (c Comment) IsBlock() bool { return len(c.Text) >= 2 && c.Text[:2] == "/*" }
+
+// A location in the source code - the lexer keeps one of these up to date as it moves through the input
+type Position struct {
+	Filename string // Name of the source file, if the lexer was given one
+	Line int // Starting at 1
+	Column int // Starting at 1
+	Offset int // Byte offset into the input, starting at 0
+}
+
+// A position is only valid once the lexer has filled it in - line numbers start at 1
+func (pos Position) IsValid() bool { return pos.Line > 0 }
+
+// Positions print as "file:line:column", or just "line:column" if there is no file name
+func (pos Position) String() string {
+	if !pos.IsValid() {
+		if pos.Filename != "" {
+			return pos.Filename
+		}
+		return "-"
+	}
+	if pos.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d", pos.Filename, pos.Line, pos.Column)
+	}
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
 }
 
 const (
@@ -14,6 +54,8 @@ const (
 	// Identifiers + literals
 	IDENT		= "IDENT" // add, foobar, x, y, ...
 	INT 		= "INT" // 123456
+	FLOAT		= "FLOAT" // 3.14, .5, 1e-9
+	STRING		= "STRING" // "foobar"
 
 	// Operators
 	ASSIGN		= "="
@@ -22,19 +64,36 @@ const (
 	BANG		= "!"
 	ASTERISK	= "*"
 	SLASH		= "/"
+	PERCENT		= "%"
 	LT			= "<"
 	GT			= ">"
+	LT_EQ		= "<="
+	GT_EQ		= ">="
 	EQ			= "=="
 	NOT_EQ		= "!="
+	AND			= "&&"
+	OR			= "||"
+	PIPE		= "|>"
+
+	// Compound assignment
+	PLUS_ASSIGN		= "+="
+	MINUS_ASSIGN	= "-="
+	ASTERISK_ASSIGN	= "*="
+	SLASH_ASSIGN	= "/="
 
 	// Delimiters
 	COMMA		= ","
 	SEMICOLON 	= ";" 
+	ELLIPSIS	= "..."
+	COLON		= ":"
+	QUESTION	= "?"
 
 	LPAREN 		= "("
 	RPAREN		= ")"
 	LBRACE		= "{"
 	RBRACE		= "}"
+	LBRACKET	= "["
+	RBRACKET	= "]"
 
 	// Keywords
 	FUNCTION	= "FUNCTION"
@@ -44,6 +103,10 @@ const (
 	IF			= "IF"
 	ELSE		= "ELSE"
 	RETURN		= "RETURN"
+	WHILE		= "WHILE"
+	FOR			= "FOR"
+	BREAK		= "BREAK"
+	CONTINUE	= "CONTINUE"
 
 )
 
@@ -55,6 +118,10 @@ var keywords = map[string]TokenType{
 	"if": 		IF,
 	"else":		ELSE,
 	"return":	RETURN,
+	"while":	WHILE,
+	"for":		FOR,
+	"break":	BREAK,
+	"continue":	CONTINUE,
 }
 
 func LookupIdent(ident string) TokenType {
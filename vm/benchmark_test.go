@@ -0,0 +1,63 @@
+package vm
+
+// Compare running the same program on the VM and on the tree-walking evaluator:
+//   go test ./vm -bench Fibonacci
+
+import (
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/object"
+	"testing"
+)
+
+const fibonacciInput = `
+let fibonacci = fn(x) {
+	if (x == 0) {
+		0
+	} else {
+		if (x == 1) {
+			return 1;
+		} else {
+			fibonacci(x - 1) + fibonacci(x - 2);
+		}
+	}
+};
+fibonacci(20);
+`
+
+const fibonacciResult = 6765
+
+func BenchmarkFibonacciVM(b *testing.B) {
+	program := parse(fibonacciInput)
+
+	for i := 0; i < b.N; i++ {
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			b.Fatalf("compiler error: %s", err)
+		}
+
+		machine := New(comp.Bytecode())
+		err = machine.Run()
+		if err != nil {
+			b.Fatalf("vm error: %s", err)
+		}
+
+		if err := testIntegerObject(fibonacciResult, machine.LastPoppedStackElem()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFibonacciEval(b *testing.B) {
+	program := parse(fibonacciInput)
+
+	for i := 0; i < b.N; i++ {
+		env := object.NewEnvironment()
+		result := evaluator.Eval(program, env)
+
+		if err := testIntegerObject(fibonacciResult, result); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
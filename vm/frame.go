@@ -0,0 +1,28 @@
+package vm
+
+import (
+	"monkey/code"
+	"monkey/object"
+)
+
+// A call frame - the closure being run, where we are in it, and where its locals start on the stack
+type Frame struct {
+	cl          *object.Closure
+	ip          int // Instruction pointer into cl.Fn.Instructions
+	basePointer int // Stack pointer before the call - locals live just above it, and we reset to it when returning
+	loops       []int // Stack pointer when each loop we are in started, innermost last
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	f := &Frame{
+		cl:          cl,
+		ip:          -1, // The run loop increments before fetching
+		basePointer: basePointer,
+	}
+
+	return f
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
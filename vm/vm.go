@@ -0,0 +1,876 @@
+package vm
+
+// A stack machine that runs the bytecode the compiler produced
+
+import (
+	"fmt"
+	"math"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+)
+
+const StackSize = 2048
+const GlobalsSize = 65536 // Global indexes are two byte operands
+const MaxFrames = 1024
+
+// Same singletons as the evaluator uses - comparing booleans is comparing pointers
+var True = &object.Boolean{Value: true}
+var False = &object.Boolean{Value: false}
+var Null = &object.Null{}
+
+type VM struct {
+	constants []object.Object
+
+	stack []object.Object
+	sp    int // Always points to the next free slot - the top of the stack is stack[sp-1]
+
+	globals []object.Object
+
+	frames      []*Frame
+	framesIndex int
+
+	lastPopped object.Object // What the last OpPop (or a top level return) left behind - the value of the program
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	// The main program runs as if it were the body of a function with no parameters
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants: bytecode.Constants,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals: make([]object.Object, GlobalsSize),
+
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// A VM that shares the globals store of a previous one - the REPL needs this so bindings survive from one line to the next
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow: more than %d nested calls", MaxFrames)
+	}
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// The value of the last expression statement the program ran
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.lastPopped
+}
+
+// The fetch-decode-execute loop
+func (vm *VM) Run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.push(vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			vm.lastPopped = vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod:
+			err := vm.executeBinaryOperation(op)
+			if err != nil {
+				return err
+			}
+
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual, code.OpLessThan, code.OpLessThanOrEqual:
+			err := vm.executeComparison(op)
+			if err != nil {
+				return err
+			}
+
+		case code.OpBang:
+			err := vm.push(nativeBoolToBooleanObject(!isTruthy(vm.pop())))
+			if err != nil {
+				return err
+			}
+
+		case code.OpMinus:
+			err := vm.executeMinusOperator()
+			if err != nil {
+				return err
+			}
+
+		case code.OpTrue:
+			err := vm.push(True)
+			if err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			err := vm.push(False)
+			if err != nil {
+				return err
+			}
+
+		case code.OpNull:
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1 // The loop increments before fetching
+
+		case code.OpLoopEnter:
+			frame := vm.currentFrame()
+			frame.loops = append(frame.loops, vm.sp)
+
+		case code.OpLoopLeave:
+			frame := vm.currentFrame()
+			frame.loops = frame.loops[:len(frame.loops)-1]
+
+		case code.OpLoopJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+
+			frame := vm.currentFrame()
+			vm.sp = frame.loops[len(frame.loops)-1]
+			frame.ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpJumpIfFalseOrPop, code.OpJumpIfTrueOrPop:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			// Peek rather than pop - if we jump, the condition is the value of the whole expression
+			if isTruthy(vm.stack[vm.sp-1]) == (op == code.OpJumpIfTrueOrPop) {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.pop()
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			// When a hoisted function runs before a let it uses, or in the REPL, when a line that defined the name failed to compile before it was set
+			if vm.globals[globalIndex] == nil {
+				return fmt.Errorf("global %d used before it was bound", globalIndex)
+			}
+
+			err := vm.push(vm.globals[globalIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			// Once a closure has captured the local, the value goes into the cell they share
+			frame := vm.currentFrame()
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := (*slot).(*object.Cell); ok {
+				cell.Value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			value := vm.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := value.(*object.Cell); ok {
+				value = cell.Value
+			}
+			// A let that never ran - in an if branch that wasn't taken, say - still has its slot, but nothing in it
+			if value == nil {
+				return fmt.Errorf("local %d used before it was bound", localIndex)
+			}
+
+			err := vm.push(value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			// Empty if the closure was created before the variable it captured was bound, and is called before it is
+			cell := vm.currentFrame().cl.Free[freeIndex].(*object.Cell)
+			if cell.Value == nil {
+				return fmt.Errorf("free variable %d used before it was bound", freeIndex)
+			}
+
+			err := vm.push(cell.Value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			cell := vm.currentFrame().cl.Free[freeIndex].(*object.Cell)
+			cell.Value = vm.pop()
+
+		case code.OpGetLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			cell, ok := (*slot).(*object.Cell)
+			if !ok {
+				cell = &object.Cell{Value: *slot}
+				*slot = cell
+			}
+
+			err := vm.push(cell)
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.push(vm.currentFrame().cl.Free[freeIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			err := vm.push(array)
+			if err != nil {
+				return err
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			err = vm.push(hash)
+			if err != nil {
+				return err
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeIndexExpression(left, index)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeSetIndex(left, index, value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpDup:
+			count := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			start := vm.sp - count
+			for i := 0; i < count; i++ {
+				err := vm.push(vm.stack[start+i])
+				if err != nil {
+					return err
+				}
+			}
+
+		case code.OpJumpIfArgument:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			pos := int(code.ReadUint16(ins[ip+2:]))
+			vm.currentFrame().ip += 3
+
+			if vm.stack[vm.currentFrame().basePointer+int(localIndex)] != nil {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.executeCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			if vm.framesIndex == 1 { // A return at the top level ends the program
+				vm.lastPopped = returnValue
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1 // Also drops the closure that was called
+
+			err := vm.push(returnValue)
+			if err != nil {
+				return err
+			}
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			err := vm.pushClosure(int(constIndex), int(numFree))
+			if err != nil {
+				return err
+			}
+
+		default:
+			def, err := code.Lookup(byte(op))
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("unhandled opcode %s", def.Name)
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// The error messages match the evaluator's, so both engines report problems the same way
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+		return vm.executeBinaryIntegerOperation(op, left, right)
+	case isNumber(left) && isNumber(right): // At least one of them is a float, so the integer gets promoted
+		return vm.executeBinaryFloatOperation(op, left, right)
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
+		return vm.executeBinaryStringOperation(op, left, right)
+	case leftType != rightType:
+		return fmt.Errorf("type mismatch: %s %s %s", leftType, operatorSymbol(op), rightType)
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", leftType, operatorSymbol(op), rightType)
+	}
+}
+
+func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.Integer).Value
+	rightValue := right.(*object.Integer).Value
+
+	var result int64
+
+	switch op {
+	case code.OpAdd:
+		result = leftValue + rightValue
+	case code.OpSub:
+		result = leftValue - rightValue
+	case code.OpMul:
+		result = leftValue * rightValue
+	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		result = leftValue / rightValue
+	case code.OpMod:
+		if rightValue == 0 {
+			return fmt.Errorf("modulo by zero")
+		}
+		result = leftValue % rightValue
+	default:
+		return fmt.Errorf("unknown integer operator: %d", op)
+	}
+
+	return vm.push(&object.Integer{Value: result})
+}
+
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	var result float64
+
+	switch op {
+	case code.OpAdd:
+		result = leftValue + rightValue
+	case code.OpSub:
+		result = leftValue - rightValue
+	case code.OpMul:
+		result = leftValue * rightValue
+	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		result = leftValue / rightValue
+	case code.OpMod:
+		if rightValue == 0 {
+			return fmt.Errorf("modulo by zero")
+		}
+		result = math.Mod(leftValue, rightValue)
+	default:
+		return fmt.Errorf("unknown float operator: %d", op)
+	}
+
+	return vm.push(&object.Float{Value: result})
+}
+
+func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
+	if op != code.OpAdd {
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operatorSymbol(op), right.Type())
+	}
+
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	return vm.push(&object.String{Value: leftValue + rightValue})
+}
+
+func (vm *VM) executeComparison(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
+		return vm.executeIntegerComparison(op, left, right)
+	}
+
+	if isNumber(left) && isNumber(right) {
+		return vm.executeFloatComparison(op, left, right)
+	}
+
+	if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
+		return vm.executeStringComparison(op, left, right)
+	}
+
+	// Everything else is a singleton (or compared by identity), so pointer equality is enough
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(right == left))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(right != left))
+	default:
+		if left.Type() != right.Type() {
+			return fmt.Errorf("type mismatch: %s %s %s", left.Type(), operatorSymbol(op), right.Type())
+		}
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operatorSymbol(op), right.Type())
+	}
+}
+
+func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.Integer).Value
+	rightValue := right.(*object.Integer).Value
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+func (vm *VM) executeFloatComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+func (vm *VM) executeStringComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operatorSymbol(op), right.Type())
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+
+	if operand.Type() == object.FLOAT_OBJ {
+		return vm.push(&object.Float{Value: -operand.(*object.Float).Value})
+	}
+
+	if operand.Type() != object.INTEGER_OBJ {
+		return fmt.Errorf("unknown operator: -%s", operand.Type())
+	}
+
+	value := operand.(*object.Integer).Value
+	return vm.push(&object.Integer{Value: -value})
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// Only call this on something isNumber() said yes to
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+// The source spelling of an operator opcode, for error messages
+func operatorSymbol(op code.Opcode) string {
+	switch op {
+	case code.OpAdd:
+		return "+"
+	case code.OpSub:
+		return "-"
+	case code.OpMul:
+		return "*"
+	case code.OpDiv:
+		return "/"
+	case code.OpMod:
+		return "%"
+	case code.OpEqual:
+		return "=="
+	case code.OpNotEqual:
+		return "!="
+	case code.OpGreaterThan:
+		return ">"
+	case code.OpGreaterThanOrEqual:
+		return ">="
+	case code.OpLessThan:
+		return "<"
+	case code.OpLessThanOrEqual:
+		return "<="
+	}
+	return "?"
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		pair := object.HashPair{Key: key, Value: value}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		hashedPairs[hashKey.HashKey()] = pair
+	}
+
+	return &object.Hash{Pairs: hashedPairs}, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	default:
+		return fmt.Errorf("index operator not supported: %s[%s]", left.Type(), index.Type())
+	}
+}
+
+// Indexing past either end of an array gives null rather than an error
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arrayObject := array.(*object.Array)
+	i := index.(*object.Integer).Value
+	max := int64(len(arrayObject.Elements) - 1)
+
+	if i < 0 || i > max {
+		return vm.push(Null)
+	}
+
+	return vm.push(arrayObject.Elements[i])
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(pair.Value)
+}
+
+// Arrays and hashes are changed in place, and the value goes back on the stack as the result of the assignment
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		array := left.(*object.Array)
+		i := index.(*object.Integer).Value
+		if i < 0 || i >= int64(len(array.Elements)) {
+			return fmt.Errorf("index out of range: %d, array has %d elements", i, len(array.Elements))
+		}
+		array.Elements[i] = value
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		left.(*object.Hash).Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+	default:
+		return fmt.Errorf("index assignment not supported: %s[%s]", left.Type(), index.Type())
+	}
+
+	return vm.push(value)
+}
+
+// The callee sits on the stack just below its arguments
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	cl, ok := callee.(*object.Closure)
+	if !ok {
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+
+	return vm.callClosure(cl, numArgs)
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	fn := cl.Fn
+	if numArgs < fn.NumRequired || !fn.Variadic && numArgs > fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%s, got=%d",
+			wantArguments(fn), numArgs)
+	}
+
+	// Arguments left over after the named parameters get collected into the rest parameter
+	var rest []object.Object
+	if fn.Variadic {
+		extra := 0
+		if numArgs > fn.NumParameters {
+			extra = numArgs - fn.NumParameters
+		}
+		rest = make([]object.Object, extra)
+		copy(rest, vm.stack[vm.sp-extra:vm.sp])
+		vm.sp -= extra
+		numArgs -= extra
+	}
+
+	// The arguments are already in place as the first locals
+	basePointer := vm.sp - numArgs
+	if basePointer+fn.NumLocals >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	// Parameters the caller left out start off empty, which tells OpJumpIfArgument to run their default instead
+	for i := numArgs; i < fn.NumParameters; i++ {
+		vm.stack[basePointer+i] = nil
+	}
+	if fn.Variadic {
+		vm.stack[basePointer+fn.NumParameters] = &object.Array{Elements: rest}
+	}
+	// The other locals may still hold cells from an earlier call that used the same stack - OpSetLocal would write into those
+	firstLocal := fn.NumParameters
+	if fn.Variadic {
+		firstLocal += 1
+	}
+	for i := firstLocal; i < fn.NumLocals; i++ {
+		vm.stack[basePointer+i] = nil
+	}
+
+	frame := NewFrame(cl, basePointer)
+	err := vm.pushFrame(frame)
+	if err != nil {
+		return err
+	}
+
+	vm.sp = frame.basePointer + fn.NumLocals
+
+	return nil
+}
+
+// Describe the number of arguments a function wants, for error messages - 2, 1..3 or 1+
+func wantArguments(fn *object.CompiledFunction) string {
+	switch {
+	case fn.Variadic:
+		return fmt.Sprintf("%d+", fn.NumRequired)
+	case fn.NumRequired != fn.NumParameters:
+		return fmt.Sprintf("%d..%d", fn.NumRequired, fn.NumParameters)
+	default:
+		return fmt.Sprintf("%d", fn.NumRequired)
+	}
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	// Captured variables arrive as cells, which the closure shares with the function it captured them from
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+// Everything except null and false counts as true - same as the evaluator
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
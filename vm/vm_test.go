@@ -0,0 +1,694 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"2", 2},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"1 * 2", 2},
+		{"4 / 2", 2},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-5", -5},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"10 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 + 10 % 4 * 3", 8},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"7 / 2.0", 3.5},
+		{"5.5 % 2", 1.5},
+		{"1.5 < 2", true},
+		{"2 <= 1.5", false},
+		{"2.0 == 2", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 0; let sum = 0; while (i < 5) { let sum = sum + i; let i = i + 1; }; sum", 10},
+		{"let sum = 0; for (let i = 0; i < 5;) { let sum = sum + i; let i = i + 1; }; sum", 10},
+		{"let i = 0; while (true) { if (i == 3) { break; } let i = i + 1; }; i", 3},
+		{"let n = 0; for (let i = 0; i < 10;) { let i = i + 1; if (i % 2 == 0) { continue; } let n = n + 1; }; n", 5},
+		{"let i = 0; for (;;) { let i = i + 1; if (i > 4) { break } }; i", 5},
+		{"let f = fn() { let i = 0; while (true) { if (i == 7) { return i; } let i = i + 1; } }; f()", 7},
+		{"let f = fn(n) { let total = 0; for (let i = 1; i <= n;) { let total = total + i; let i = i + 1; } total }; f(100)", 5050},
+		{`
+let count = 0;
+for (let i = 0; i < 3;) {
+	for (let j = 0; j < 10;) {
+		if (j == 2) { break; }
+		let count = count + 1;
+		let j = j + 1;
+	}
+	let i = i + 1;
+}
+count`, 6},
+		{"let f = fn() { while (false) { 1 } }; f()", Null},
+		{"while (false) { 1 }", Null},
+		// A loop is null, whatever its body's last expression was
+		{"let i = 0; while (i < 2) { let i = i + 1; i * 10 }", Null},
+		{"for (;;) { 1; break }", Null},
+		// break, continue and return end the loop (or function) even from inside an expression
+		{"let x = 0; let i = 0; while (i < 5) { let y = if (i > 2) { break; } else { i }; let x = x + y; let i = i + 1 }; x", 3},
+		{"let x = 0; let i = 0; while (i < 5) { let i = i + 1; let y = -if (i % 2 == 0) { continue } else { i }; let x = x + y }; x", -9},
+		{"let f = fn() { let y = if (true) { return 5 } else { 1 }; y + 100 }; f()", 5},
+		// ... and throw away whatever that expression had already pushed, however often they do it
+		{"let i = 0; while (i < 5000) { let i = i + 1; [1, if (true) { continue } else { 2 }] }; i", 5000},
+		{"let n = 0; for (let i = 0; i < 5000;) { let i = i + 1; let n = n + 1 + if (true) { continue } else { 2 } }; n", 0},
+		{"let n = 0; for (let i = 0; i < 5000;) { let i = i + 1; [i, if (true) { for (;;) { [1, 2, if (true) { break } else { 3 }] } }]; let n = n + 1 }; n", 5000},
+		{"let f = fn(x) { while (true) { [x, x, if (true) { break } else { 1 }] } x }; let s = 0; for (let i = 0; i < 5000;) { let s = s + f(i) - i; let i = i + 1 }; s", 0},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; x = 5; x", 5},
+		{"let x = 1; x = x + 1", 2},
+		{"let x = 10; x += 5; x", 15},
+		{"let x = 10; x -= 5; x", 5},
+		{"let x = 10; x *= 5; x", 50},
+		{"let x = 10; x /= 5; x", 2},
+		{"let x = 1; let y = 2; x = y = 7; x + y", 14},
+		{"let arr = [1, 2, 3]; arr[1] = 20; arr", []int{1, 20, 3}},
+		{"let arr = [1, 2, 3]; arr[2] += 10; arr[2]", 13},
+		{`let h = {"a": 1}; h["a"] = 5; h["a"]`, 5},
+		{`let h = {}; h["new"] = 3; h["new"]`, 3},
+		{"let n = 0; let inc = fn() { n = n + 1 }; inc(); inc(); n", 2},
+		{"let f = fn() { let x = 1; x += 4; x }; f()", 5},
+		{"let a = [1]; let b = a; b[0] = 9; a[0]", 9},
+		{"let i = 0; let sum = 0; while (i < 4) { sum += i; i += 1; } sum", 6},
+		{"let sum = 0; for (let i = 0; i < 5; i += 1) { sum += i }; sum", 10},
+		{"let calls = 0; let f = fn() { calls += 1; 0 }; let a = [1]; a[f()] += 1; calls", 1},
+		// Both sides of a comparison run left to right, so the last assignment wins
+		{"let x = 0; (x = 1) < (x = 2); x", 2},
+		{"let x = 0; (x = 1) <= (x = 2); x", 2},
+		{"let x = 0; (x = 3) < (x += 1)", true},
+		// A compound assignment reads the current value before the right side runs, also left to right
+		{"let x = 1; x += (x = 10); x", 11},
+		{"let a = [1]; a[0] += (a[0] = 10); a[0]", 11},
+		{`let h = {"k": 2}; h["k"] *= (h["k"] = 5); h["k"]`, 10},
+		{"let f = fn() { let x = 1; let set = fn() { x = 10 }; x += set(); x }; f()", 11},
+		// A function's name inside its body is the variable it is bound to, so assigning to it rebinds that variable
+		{"let f = fn() { f = 5 }; f(); f", 5},
+		{"let f = fn() { f = 5; f }; f()", 5},
+		{"let f = fn() { let g = fn() { f = 1 }; g() }; f(); f", 1},
+		{"let outer = fn() { let f = fn() { f = 5 }; f(); f }; outer()", 5},
+		{"fn f() { f = 3 } f(); f", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFunctionDeclarations(t *testing.T) {
+	tests := []vmTestCase{
+		{"fn add(a, b) { a + b } add(2, 3)", 5},
+		{"let x = double(4); fn double(n) { n * 2 } x", 8},
+		{`
+fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }
+fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }
+isEven(10)`, true},
+		{`
+let f = fn() {
+	let r = helper(3);
+	fn base() { 10 }
+	fn helper(n) { base() + n }
+	r
+};
+f()`, 13},
+		// A declaration can use the block's let bindings, wherever they are written
+		{"let x = 1; fn f() { x } f()", 1},
+		{"fn f() { g() } let g = fn() { 7 }; f()", 7},
+		{"let n = 2; fn scale(v) { v * n } n = 5; scale(3)", 15},
+		{"let f = fn() { let x = 4; fn get() { x } get() }; f()", 4},
+		{"let f = fn() { fn get() { x } let x = 4; get() }; f()", 4},
+		// ... but the rest of the block only sees them once their let runs, so the x on the right is still the outer one
+		{"let x = 1; let f = fn() { fn g() { x }; let x = x + 1; x }; f()", 2},
+		{"let x = 1; let f = fn() { fn g() { x }; let x = x + 1; g() }; f()", 2},
+		{"let x = 1; fn g() { x } let x = x + 1; g()", 2},
+		// Inside a function too, declarations can call each other whatever order they are written in
+		{`
+let outer = fn() {
+	fn a(n) { if (n == 0) { 0 } else { b(n - 1) } }
+	fn b(n) { a(n) }
+	a(3)
+};
+outer()`, 0},
+		{`
+let parity = fn(n) {
+	fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }
+	fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }
+	if (isEven(n) && !isOdd(n)) { 0 } else { 1 }
+};
+[parity(4), parity(7)]`, []int{0, 1}},
+		// A declaration's value is null, so a block ending in one doesn't take the value of the statement before it
+		{"let f = fn() { 1; fn inner() { 2 } }; f()", Null},
+		{"if (true) { 1; fn inner() { 2 } }", Null},
+		{"let f = fn() { fn inner() { 2 } inner() }; f()", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn(a, b = 10) { a + b }; f(1)", 11},
+		{"let f = fn(a, b = 10) { a + b }; f(1, 2)", 3},
+		{"let f = fn(a, b = a * 2) { a + b }; f(3)", 9},
+		{"let n = 0; let f = fn(a = n += 1) { a }; f(); f(); f()", 3},
+		{"let f = fn(a, ...rest) { rest }; f(1)", []int{}},
+		{"let f = fn(a, ...rest) { rest }; f(1, 2, 3)", []int{2, 3}},
+		{"let f = fn(...rest) { rest[1] }; f(4, 5, 6)", 5},
+		{"let f = fn(a, b = 2, ...rest) { b }; f(1)", 2},
+		{"let f = fn(a = 1, b = 2) { a * 10 + b }; f()", 12},
+		{"let f = fn(x = 5) { let y = x * 2; y }; f()", 10},
+		{"let k = 3; let f = fn() { fn(a = k) { a } }; f()()", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestPipeExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let double = fn(x) { x * 2 }; 5 |> double", 10},
+		{"let double = fn(x) { x * 2 }; 5 |> double()", 10},
+		{"let sub = fn(a, b) { a - b }; 10 |> sub(3)", 7},
+		{"let sub = fn(a, b) { a - b }; let double = fn(x) { x * 2 }; 10 |> sub(4) |> double", 12},
+		{"let add = fn(a, b) { a + b }; 1 + 2 |> add(10)", 13},
+		{"4 |> fn(x) { x * x }", 16},
+		{"let adder = fn(n) { fn(x, y) { x + y + n } }; 1 |> adder(100)(10)", 111},
+		{"let f = fn(a, ...rest) { rest }; 1 |> f(2, 3)", []int{2, 3}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"0 || 5", 0},
+		{"5 && 7", 7},
+		{"let f = fn() { 1 / 0 }; true || f()", true},
+		{"true == true", true},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"1 == true", false},
+		{"!true", false},
+		{"!5", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 } ", 20},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", Null},
+		{"if (false) { 10 }", Null},
+		{"if (true) { }", Null},
+		{"if (true) { let a = 1; }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (false) { 10 } else if (true) { 20 } else { 30 }", 20},
+		{"if (false) { 10 } else if (false) { 20 } else { 30 }", 30},
+		{"if (false) { 10 } else if (false) { 20 }", Null},
+		{"let x = 5; if (x < 0) { 1 } else if (x < 3) { 2 } else if (x < 10) { 3 } else { 4 }", 3},
+		{"let n = 0; if (true) { n += 1 } else if (n += 10) { n += 100 }; n", 1},
+		{"let n = 0; let i = 0; while (i < 3) { i += 1; if (false) { 1 } else if (if (true) { continue } else { false }) { n += 1 } }; n", 0},
+		{"true ? 1 : 2", 1},
+		{"false ? 1 : 2", 2},
+		{"0 ? 1 : 2", 1},
+		{"1 > 2 ? 10 : 1 < 2 ? 20 : 30", 20},
+		{"let x = false ? 1 : true ? 2 : 3; x", 2},
+		{"let f = fn() { 1 / 0 }; true ? 5 : f()", 5},
+		{"let n = 0; false ? n = 1 : n; n", 0},
+		{"let n = 0; let i = 0; while (i < 3) { i += 1; n += (if (true) { continue } else { true }) ? 1 : 2 }; n", 0},
+		{"(true ? fn(x) { x * 2 } : fn(x) { x })(4)", 8},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = 2; one + two", 3},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let x = 1; let x = x + 1; x", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"monkey"`, "monkey"},
+		{`"mon" + "key"`, "monkey"},
+		{`"mon" + "key" + "banana"`, "monkeybanana"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2, 3]", []int{1, 2, 3}},
+		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			"{}", map[object.HashKey]int64{},
+		},
+		{
+			"{1: 2, 2: 3}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey(): 2,
+				(&object.Integer{Value: 2}).HashKey(): 3,
+			},
+		},
+		{
+			"{1 + 1: 2 * 2, 3 + 3: 4 * 4}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 2}).HashKey(): 4,
+				(&object.Integer{Value: 6}).HashKey(): 16,
+			},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][1]", 2},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"[][0]", Null},
+		{"[1, 2, 3][99]", Null},
+		{"[1][-1]", Null},
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{1: 1, 2: 2}[2]", 2},
+		{"{1: 1}[0]", Null},
+		{"{}[0]", Null},
+		{`{"one": 1}["o" + "ne"]`, 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let a = fn() { 1 }; let b = fn() { a() + 1 }; b()", 2},
+		{"let earlyExit = fn() { return 99; 100; }; earlyExit();", 99},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let identity = fn(a) { a; }; identity(4);", 4},
+		{"let sum = fn(a, b) { a + b; }; sum(1, 2);", 3},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{"fn(x) { x; }(5)", 5},
+		{`
+		let globalSeed = 50;
+		let minusOne = fn() {
+			let num = 1;
+			globalSeed - num;
+		}
+		let minusTwo = fn() {
+			let num = 2;
+			globalSeed - num;
+		}
+		minusOne() + minusTwo();
+		`, 97},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", 10},
+		{"let f = fn(x) { if (x > 1) { if (x > 2) { return x; } } return 0; }; f(5) + 1;", 6},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{`
+		let newClosure = fn(a) {
+			fn() { a; };
+		};
+		let closure = newClosure(99);
+		closure();
+		`, 99},
+		{`
+		let newAdder = fn(a, b) {
+			let c = a + b;
+			fn(d) { c + d };
+		};
+		let adder = newAdder(1, 2);
+		adder(8);
+		`, 11},
+		{`
+		let newClosure = fn(a, b) {
+			let one = fn() { a; };
+			let two = fn() { b; };
+			fn() { one() + two(); };
+		};
+		let closure = newClosure(9, 90);
+		closure();
+		`, 99},
+		// A captured variable is shared, not copied - assignments on either side are seen by the other
+		{"let make = fn() { let n = 0; let inc = fn() { n += 1 }; inc(); n }; make()", 1},
+		{`
+		let counter = fn() {
+			let count = 0;
+			fn() { count += 1 }
+		};
+		let a = counter();
+		let b = counter();
+		a(); a(); b();
+		[a(), b()]
+		`, []int{3, 2}},
+		{"let f = fn() { let x = 1; let get = fn() { x }; x = 5; get() }; f()", 5},
+		{"let f = fn() { let x = 1; let g = fn() { fn() { x *= 10 } }; g()(); g()(); x }; f()", 100},
+		{"let f = fn(x) { let set = fn(v) { x = v }; set(7); x }; f(1)", 7},
+		{"let f = fn(...xs) { let set = fn(v) { xs = v }; set(4); xs }; f(0, 0)", 4},
+		// Each call gets its own variables, even if an earlier call at the same depth left a cell behind
+		{"let f = fn(v) { let x = v; let get = fn() { x }; get }; let a = f(1); let b = f(2); a() + b()", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`
+		let countDown = fn(x) {
+			if (x == 0) {
+				return 0;
+			} else {
+				countDown(x - 1);
+			}
+		};
+		countDown(1);
+		`, 0},
+		{`
+		let wrapper = fn() {
+			let countDown = fn(x) {
+				if (x == 0) {
+					return 0;
+				} else {
+					countDown(x - 1);
+				}
+			};
+			countDown(1);
+		};
+		wrapper();
+		`, 0},
+		{`
+		let fibonacci = fn(x) {
+			if (x == 0) {
+				return 0;
+			} else {
+				if (x == 1) {
+					return 1;
+				} else {
+					fibonacci(x - 1) + fibonacci(x - 2);
+				}
+			}
+		};
+		fibonacci(15);
+		`, 610},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{`"a" - "b"`, "unknown operator: STRING - STRING"},
+		{"5 / 0", "division by zero"},
+		{"5 % 0", "modulo by zero"},
+		{"let a = [1]; a[5] = 1", "index out of range: 5, array has 1 elements"},
+		{"let x = 1; x[0] = 1", "index assignment not supported: INTEGER[INTEGER]"},
+		{"1.5 / 0", "division by zero"},
+		{"true >= false", "unknown operator: BOOLEAN >= BOOLEAN"},
+		{"true < false", "unknown operator: BOOLEAN < BOOLEAN"},
+		{`1 <= "a"`, "type mismatch: INTEGER <= STRING"},
+		{"fn() { 1; }(1);", "wrong number of arguments: want=0, got=1"},
+		{"fn(a, b) { a + b; }(1);", "wrong number of arguments: want=2, got=1"},
+		{"fn(a, b = 2) { a; }(1, 2, 3);", "wrong number of arguments: want=1..2, got=3"},
+		{"fn(a, ...rest) { a; }();", "wrong number of arguments: want=1+, got=0"},
+		{"5(1)", "not a function: INTEGER"},
+		{"1 |> 2", "not a function: INTEGER"},
+		{`[1, 2]["a"]`, "index operator not supported: ARRAY[STRING]"},
+		{`{fn(x) { x }: 1}`, "unusable as hash key: CLOSURE"},
+		{"let f = fn() { f() }; f()", "stack overflow: more than 1024 nested calls"},
+		{"fn f() { x } f(); let x = 1;", "global 1 used before it was bound"},
+		{"let g = fn() { fn f() { x } f(); let x = 1; }; g()", "free variable 0 used before it was bound"},
+		{"let g = fn() { if (false) { let x = 1; } x }; g()", "local 0 used before it was bound"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error for %q but resulted in none.", tt.input)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error for %q: want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		stackElem := vm.LastPoppedStackElem()
+
+		testExpectedObject(t, tt.input, tt.expected, stackElem)
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		err := testIntegerObject(int64(expected), actual)
+		if err != nil {
+			t.Errorf("testIntegerObject failed for %q: %s", input, err)
+		}
+
+	case bool:
+		err := testBooleanObject(expected, actual)
+		if err != nil {
+			t.Errorf("testBooleanObject failed for %q: %s", input, err)
+		}
+
+	case float64:
+		result, ok := actual.(*object.Float)
+		if !ok {
+			t.Errorf("object is not Float for %q. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if result.Value != expected {
+			t.Errorf("object has wrong value for %q. got=%g, want=%g", input, result.Value, expected)
+		}
+
+	case string:
+		err := testStringObject(expected, actual)
+		if err != nil {
+			t.Errorf("testStringObject failed for %q: %s", input, err)
+		}
+
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array for %q: %T (%+v)", input, actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements for %q. want=%d, got=%d",
+				input, len(expected), len(array.Elements))
+			return
+		}
+
+		for i, expectedElem := range expected {
+			err := testIntegerObject(int64(expectedElem), array.Elements[i])
+			if err != nil {
+				t.Errorf("testIntegerObject failed for %q: %s", input, err)
+			}
+		}
+
+	case map[object.HashKey]int64:
+		hash, ok := actual.(*object.Hash)
+		if !ok {
+			t.Errorf("object is not Hash for %q. got=%T (%+v)", input, actual, actual)
+			return
+		}
+
+		if len(hash.Pairs) != len(expected) {
+			t.Errorf("hash has wrong number of Pairs for %q. want=%d, got=%d",
+				input, len(expected), len(hash.Pairs))
+			return
+		}
+
+		for expectedKey, expectedValue := range expected {
+			pair, ok := hash.Pairs[expectedKey]
+			if !ok {
+				t.Errorf("no pair for given key in Pairs for %q", input)
+			}
+
+			err := testIntegerObject(expectedValue, pair.Value)
+			if err != nil {
+				t.Errorf("testIntegerObject failed for %q: %s", input, err)
+			}
+		}
+
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("object is not Null for %q: %T (%+v)", input, actual, actual)
+		}
+	}
+}
+
+func testIntegerObject(expected int64, actual object.Object) error {
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+	}
+
+	return nil
+}
+
+func testBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%t, want=%t",
+			result.Value, expected)
+	}
+
+	return nil
+}
+
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q",
+			result.Value, expected)
+	}
+
+	return nil
+}